@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 每个订阅者的事件队列长度
+const subscriberQueueSize = 64
+
+// slowPolicy 决定订阅者队列已满时如何处理新事件。
+// 发布者永远不会因为某个订阅者消费过慢而被阻塞。
+type slowPolicy string
+
+const (
+	// policyDrop 丢弃该订阅者放不下的新事件，并记录丢弃数量，连接保持不变
+	policyDrop slowPolicy = "drop"
+	// policyDisconnect 直接断开该订阅者，客户端可以携带 Last-Event-ID 重连并从事件日志补齐
+	policyDisconnect slowPolicy = "disconnect"
+)
+
+func parseSlowPolicy(s string) (slowPolicy, error) {
+	switch p := slowPolicy(s); p {
+	case policyDrop, policyDisconnect:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown slow subscriber policy %q (want %q or %q)", s, policyDrop, policyDisconnect)
+	}
+}
+
+// subscriber 表示一个 SSE 连接对若干主题的订阅
+type subscriber struct {
+	topics  map[string]bool
+	events  chan sseEvent
+	kicked  chan struct{} // 因消费过慢被断开时关闭
+	dropped int
+}
+
+// broker 是按主题分发事件的发布/订阅中心
+type broker struct {
+	mu     sync.Mutex
+	seq    uint64
+	subs   map[*subscriber]struct{}
+	logs   *eventLogStore
+	policy slowPolicy
+}
+
+func newBroker(logs *eventLogStore, policy slowPolicy) *broker {
+	return &broker{
+		subs:   make(map[*subscriber]struct{}),
+		logs:   logs,
+		policy: policy,
+	}
+}
+
+// publish 向主题发布一条事件，返回事件序号和收到该事件的订阅者数量
+func (b *broker) publish(topic, event, data string) (uint64, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	ev := sseEvent{Seq: b.seq, Event: event, Data: data, At: time.Now()}
+	b.logs.getOrCreate(topic).append(ev)
+
+	delivered := 0
+	for sub := range b.subs {
+		if !sub.topics[topic] {
+			continue
+		}
+
+		select {
+		case sub.events <- ev:
+			delivered++
+			continue
+		default:
+		}
+
+		// 订阅者队列已满
+		switch b.policy {
+		case policyDisconnect:
+			log.Printf("Disconnecting slow subscriber on topic %s after event %d", topic, ev.Seq)
+			delete(b.subs, sub)
+			close(sub.kicked)
+		default:
+			sub.dropped++
+			if sub.dropped == 1 || sub.dropped%100 == 0 {
+				log.Printf("Slow subscriber on topic %s has dropped %d events", topic, sub.dropped)
+			}
+		}
+	}
+	return ev.Seq, delivered
+}
+
+// subscribe 注册订阅者。lastSeq 大于 0 时同时返回事件日志中序号更大的事件，
+// 注册和读取日志在同一把锁下完成，保证重放与实时事件之间没有空隙。
+// 日志已经无法补齐 lastSeq 之后的全部事件（被截断、已过期，或 lastSeq 不是本进程发出的序号）时
+// complete 为 false，调用方需要告知客户端有事件丢失。
+func (b *broker) subscribe(topics []string, lastSeq uint64) (sub *subscriber, replay []sseEvent, complete bool) {
+	sub = &subscriber{
+		topics: make(map[string]bool, len(topics)),
+		events: make(chan sseEvent, subscriberQueueSize),
+		kicked: make(chan struct{}),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs[sub] = struct{}{}
+
+	if lastSeq == 0 {
+		return sub, nil, true
+	}
+
+	complete = lastSeq <= b.seq
+	for topic := range sub.topics {
+		events, ok := b.logs.since(topic, lastSeq)
+		replay = append(replay, events...)
+		complete = complete && ok
+	}
+	sort.Slice(replay, func(i, j int) bool { return replay[i].Seq < replay[j].Seq })
+	return sub, replay, complete
+}
+
+// unsubscribe 注销订阅者，可以重复调用
+func (b *broker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
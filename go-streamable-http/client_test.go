@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-streamable-http/streamclient"
+)
+
+// 以下测试用 streamclient 中的消费端读取真实处理器的输出
+
+func TestClientJSONStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "plain", handler: streamJSONHandler},
+		{name: "compressed", handler: compress(streamJSONHandler)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useManualTicker(t)
+			srv := newTestServer(t, tt.handler)
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			stream, err := streamclient.OpenJSONStream(ctx, srv.Client(), srv.URL+"?count=3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+			ticker := clock.next(t)
+
+			for i := 1; i <= 3; i++ {
+				if !stream.Next() {
+					t.Fatalf("stream ended before message %d: %v", i, stream.Err())
+				}
+				if data := stream.Value(); data.Count != i {
+					t.Fatalf("message %d = %+v", i, data)
+				}
+				if i < 3 {
+					ticker.tick(t)
+				}
+			}
+			if stream.Next() {
+				t.Fatalf("unexpected message %+v", stream.Value())
+			}
+			if err := stream.Err(); err != nil {
+				t.Fatalf("stream error: %v", err)
+			}
+		})
+	}
+}
+
+// abortAfterEvent 在第一个带 id 的 SSE 事件刷新后中断连接，模拟网络断开
+type abortAfterEvent struct {
+	http.ResponseWriter
+	sawEvent bool
+}
+
+func (w *abortAfterEvent) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("id: ")) {
+		w.sawEvent = true
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *abortAfterEvent) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+	if w.sawEvent {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func TestClientSSEResume(t *testing.T) {
+	orig := sseRetry
+	sseRetry = 10 * time.Millisecond
+	t.Cleanup(func() { sseRetry = orig })
+
+	var connections atomic.Int32
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) == 1 {
+			w = &abortAfterEvent{ResponseWriter: w}
+		}
+		sseHandler(w, r)
+	})
+
+	connected := make(chan struct{}, 4)
+	client := &streamclient.SSEClient{
+		URL:            srv.URL + "?topic=client-resume&limit=2",
+		HTTPClient:     srv.Client(),
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		OnStateChange: func(state streamclient.ConnState, _ error) {
+			if state == streamclient.StateConnected {
+				connected <- struct{}{}
+			}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	var got []string
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- client.Run(ctx, func(ev streamclient.Event) error {
+			if ev.Type == "message" && ev.Data != "Connected to SSE stream" {
+				got = append(got, ev.Data)
+			}
+			return nil
+		})
+	}()
+
+	// 第一个连接只送达 e1 就断开，重连时带上 Last-Event-ID，从事件日志补齐 e2、e3
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		t.Fatal("client never connected")
+	}
+	for _, data := range []string{"e1", "e2", "e3"} {
+		sseBroker.publish("client-resume", "", data)
+	}
+
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := []string{"e1", "e2", "e3"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if n := connections.Load(); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+}
+
+func TestClientSSEStopsOnClientError(t *testing.T) {
+	srv := newTestServer(t, muxHandler)
+
+	client := &streamclient.SSEClient{URL: srv.URL, HTTPClient: srv.Client()}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	err := client.Run(ctx, func(streamclient.Event) error { return nil })
+	var statusErr *streamclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Run = %v, want 400 status error", err)
+	}
+}
+
+func TestClientSSEDrain(t *testing.T) {
+	useDraining(t)
+	orig := sseRetry
+	sseRetry = 10 * time.Millisecond
+	t.Cleanup(func() { sseRetry = orig })
+
+	// 第一个连接由正在关闭的服务器处理，之后的连接相当于滚动发布后的新实例
+	var lastEventIDs []string
+	var mu sync.Mutex
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastEventIDs)
+		mu.Unlock()
+		if n == 1 {
+			sseHandler(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: close\ndata: done\n\n")
+	})
+
+	client := &streamclient.SSEClient{
+		URL:            srv.URL + "?topic=client-drain",
+		HTTPClient:     srv.Client(),
+		InitialBackoff: 10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	var got []string
+	received := make(chan struct{}, 1)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- client.Run(ctx, func(ev streamclient.Event) error {
+			got = append(got, ev.Type+":"+ev.Data)
+			if ev.Data == "e1" {
+				received <- struct{}{}
+			}
+			return nil
+		})
+	}()
+
+	// 等订阅建立后再发布，客户端收到 e1 后服务器开始关闭
+	var id uint64
+	for id == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("client never subscribed")
+		case <-time.After(5 * time.Millisecond):
+		}
+		if n, delivered := sseBroker.publish("client-drain", "", "e1"); delivered > 0 {
+			id = n
+		}
+	}
+	<-received
+	startDraining()
+
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"message:Connected to SSE stream", "message:e1", "close:Server shutting down", "close:done"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"", fmt.Sprint(id)}; fmt.Sprint(lastEventIDs) != fmt.Sprint(want) {
+		t.Errorf("Last-Event-ID headers = %q, want %q", lastEventIDs, want)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go-streamable-http/streamclient"
+)
+
+// runBench 实现 bench 子命令：同时打开 N 个流并保持指定时长，
+// 流提前结束时立即重新打开，最后汇总首字节时间、消息间隔分位数、吞吐量和错误数
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:8080/stream/json?count=1000&interval=100ms", "压测的流地址")
+	concurrency := fs.Int("n", 10, "并发流数量")
+	duration := fs.Duration("duration", 10*time.Second, "压测时长")
+	format := fs.String("format", "table", "报告格式：table 或 json")
+	fs.Parse(args)
+
+	if *concurrency <= 0 {
+		return fmt.Errorf("-n 必须大于 0")
+	}
+	if *duration <= 0 {
+		return fmt.Errorf("-duration 必须大于 0")
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("未知的报告格式: %s", *format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	// 默认 Transport 每个主机只保留 2 个空闲连接，压测时让每个流都能复用连接
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = *concurrency
+	client := &http.Client{Transport: transport}
+
+	if *format == "table" {
+		fmt.Printf("🏋️ 压测 %s: %d 个并发流，持续 %s\n", *url, *concurrency, *duration)
+	}
+
+	stats := newBenchStats()
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := benchStream(ctx, client, *url, stats); err != nil && ctx.Err() == nil {
+					stats.addError(err)
+					// 出错后稍等再重试，避免服务器不可用时空转
+					select {
+					case <-ctx.Done():
+					case <-time.After(100 * time.Millisecond):
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := stats.report(*url, *concurrency, time.Since(started))
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	report.printTable(os.Stdout)
+	return nil
+}
+
+// benchStream 打开一个流并读取到结束，把每条消息的到达时间计入 stats。
+// ctx 结束导致的中断不算错误。
+func benchStream(ctx context.Context, client *http.Client, url string, stats *benchStats) error {
+	started := time.Now()
+	var ttfb time.Duration
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { ttfb = time.Since(started) },
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &streamclient.StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	stats.streamOpened(ttfb)
+
+	body := &countingReader{r: resp.Body}
+	var (
+		last     time.Time
+		messages int
+		gaps     []time.Duration
+	)
+	onMessage := func() {
+		now := time.Now()
+		if !last.IsZero() {
+			gaps = append(gaps, now.Sub(last))
+		}
+		last = now
+		messages++
+	}
+	defer func() { stats.streamDone(messages, body.n, gaps) }()
+
+	// SSE 按事件计数，其他流按行计数
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		reader := streamclient.NewSSEReader(ctx, body)
+		defer reader.Close()
+		for reader.Next() {
+			onMessage()
+		}
+		if err := reader.Err(); err != nil && ctx.Err() == nil {
+			return err
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		onMessage()
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
+
+// benchStats 汇总所有流的测量结果
+type benchStats struct {
+	mu       sync.Mutex
+	streams  int
+	messages int
+	bytes    int64
+	ttfbs    []time.Duration
+	gaps     []time.Duration
+	errors   map[string]int
+}
+
+func newBenchStats() *benchStats {
+	return &benchStats{errors: make(map[string]int)}
+}
+
+func (s *benchStats) streamOpened(ttfb time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams++
+	s.ttfbs = append(s.ttfbs, ttfb)
+}
+
+func (s *benchStats) streamDone(messages int, bytes int64, gaps []time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages += messages
+	s.bytes += bytes
+	s.gaps = append(s.gaps, gaps...)
+}
+
+// addError 按类别统计错误：HTTP 状态码单独计数，其他错误按连接和读取区分
+func (s *benchStats) addError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var statusErr *streamclient.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		s.errors[fmt.Sprintf("http_%d", statusErr.StatusCode)]++
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		s.errors["unexpected_eof"]++
+	default:
+		var urlErr interface{ Timeout() bool }
+		if errors.As(err, &urlErr) && urlErr.Timeout() {
+			s.errors["timeout"]++
+			return
+		}
+		s.errors["transport"]++
+	}
+}
+
+// benchReport 是压测结果，延迟单位为毫秒
+type benchReport struct {
+	URL             string         `json:"url"`
+	Concurrency     int            `json:"concurrency"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Streams         int            `json:"streams"`
+	Messages        int            `json:"messages"`
+	Bytes           int64          `json:"bytes"`
+	MessagesPerSec  float64        `json:"messages_per_sec"`
+	BytesPerSec     float64        `json:"bytes_per_sec"`
+	TTFB            latencySummary `json:"ttfb_ms"`
+	InterMessage    latencySummary `json:"inter_message_ms"`
+	Errors          map[string]int `json:"errors"`
+	ErrorsTotal     int            `json:"errors_total"`
+}
+
+// latencySummary 是一组延迟的统计值（毫秒）
+type latencySummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func (s *benchStats) report(url string, concurrency int, elapsed time.Duration) benchReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := benchReport{
+		URL:             url,
+		Concurrency:     concurrency,
+		DurationSeconds: elapsed.Seconds(),
+		Streams:         s.streams,
+		Messages:        s.messages,
+		Bytes:           s.bytes,
+		TTFB:            summarize(s.ttfbs),
+		InterMessage:    summarize(s.gaps),
+		Errors:          s.errors,
+	}
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		r.MessagesPerSec = float64(s.messages) / seconds
+		r.BytesPerSec = float64(s.bytes) / seconds
+	}
+	for _, n := range s.errors {
+		r.ErrorsTotal += n
+	}
+	return r
+}
+
+// summarize 计算延迟的最小值、平均值、分位数和最大值
+func summarize(samples []time.Duration) latencySummary {
+	if len(samples) == 0 {
+		return latencySummary{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	// 最近秩法计算分位数
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return ms(sorted[max(rank, 0)])
+	}
+	return latencySummary{
+		Count: len(sorted),
+		Min:   ms(sorted[0]),
+		Mean:  ms(total / time.Duration(len(sorted))),
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   ms(sorted[len(sorted)-1]),
+	}
+}
+
+// printTable 以表格形式输出报告
+func (r benchReport) printTable(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\n📊 压测结果（%.1fs）\n", r.DurationSeconds)
+	fmt.Fprintf(tw, "流数量\t%d\n", r.Streams)
+	fmt.Fprintf(tw, "消息数\t%d\n", r.Messages)
+	fmt.Fprintf(tw, "吞吐量\t%.1f msg/s\t%.1f KB/s\n", r.MessagesPerSec, r.BytesPerSec/1024)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "延迟 (ms)\tcount\tmin\tmean\tp50\tp90\tp99\tmax")
+	for _, row := range []struct {
+		name string
+		s    latencySummary
+	}{
+		{"首字节 (TTFB)", r.TTFB},
+		{"消息间隔", r.InterMessage},
+	} {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			row.name, row.s.Count, row.s.Min, row.s.Mean, row.s.P50, row.s.P90, row.s.P99, row.s.Max)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "错误\t%d\n", r.ErrorsTotal)
+	kinds := make([]string, 0, len(r.Errors))
+	for kind := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(tw, "  %s\t%d\n", kind, r.Errors[kind])
+	}
+	tw.Flush()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		var out []time.Duration
+		for _, v := range values {
+			out = append(out, time.Duration(v)*time.Millisecond)
+		}
+		return out
+	}
+	hundred := make([]int, 100)
+	for i := range hundred {
+		hundred[i] = 100 - i
+	}
+
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    latencySummary
+	}{
+		{"no samples", nil, latencySummary{}},
+		{"one sample", ms(7), latencySummary{Count: 1, Min: 7, Mean: 7, P50: 7, P90: 7, P99: 7, Max: 7}},
+		{"unsorted", ms(40, 10, 30, 20), latencySummary{Count: 4, Min: 10, Mean: 25, P50: 20, P90: 40, P99: 40, Max: 40}},
+		// 最近秩法：1..100 的 p50 是第 50 个，p90 是第 90 个
+		{"1 to 100", ms(hundred...), latencySummary{Count: 100, Min: 1, Mean: 50.5, P50: 50, P90: 90, P99: 99, Max: 100}},
+		{"sub-millisecond", []time.Duration{500 * time.Microsecond, 1500 * time.Microsecond}, latencySummary{Count: 2, Min: 0.5, Mean: 1, P50: 0.5, P90: 1.5, P99: 1.5, Max: 1.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(tt.samples); got != tt.want {
+				t.Errorf("summarize = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
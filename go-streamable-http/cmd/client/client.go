@@ -1,66 +1,52 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
 	"time"
-)
 
-// StreamData 与服务器端保持一致的数据结构
-type StreamData struct {
-	Timestamp int64  `json:"timestamp"`
-	Message   string `json:"message"`
-	Count     int    `json:"count"`
-}
+	"go-streamable-http/streamclient"
+)
 
 // 消费 JSON 流式响应
-func consumeJSONStream(url string) error {
+func consumeJSONStream(ctx context.Context, url string) error {
 	fmt.Printf("🔄 开始消费 JSON 流: %s\n", url)
 
-	resp, err := http.Get(url)
+	stream, err := streamclient.OpenJSONStream(ctx, nil, url)
 	if err != nil {
 		return fmt.Errorf("请求失败: %v", err)
 	}
-	defer resp.Body.Close()
+	defer stream.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("服务器返回错误状态: %d", resp.StatusCode)
-	}
-
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		var data StreamData
-		if err := json.Unmarshal([]byte(line), &data); err != nil {
-			fmt.Printf("❌ JSON 解析错误: %v, 原始数据: %s\n", err, line)
-			continue
+	for stream.Next() {
+		data := stream.Value()
+		if data.Final {
+			fmt.Println("🛑 服务器即将关闭，流已结束")
+			break
 		}
-
 		fmt.Printf("📦 收到数据: Count=%d, Message=%s, Timestamp=%d\n",
 			data.Count, data.Message, data.Timestamp)
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := stream.Err(); err != nil {
 		return fmt.Errorf("读取流时出错: %v", err)
 	}
 
-	fmt.Println("✅ JSON 流处理完成\n")
+	fmt.Print("✅ JSON 流处理完成\n\n")
 	return nil
 }
 
 // 消费文本流式响应
-func consumeTextStream(url string) error {
+func consumeTextStream(ctx context.Context, url string) error {
 	fmt.Printf("🔄 开始消费文本流: %s\n", url)
 
-	resp, err := http.Get(url)
+	resp, err := get(ctx, url)
 	if err != nil {
 		return fmt.Errorf("请求失败: %v", err)
 	}
@@ -85,85 +71,48 @@ func consumeTextStream(url string) error {
 		}
 	}
 
-	fmt.Println("\n✅ 文本流处理完成\n")
+	fmt.Print("\n✅ 文本流处理完成\n\n")
 	return nil
 }
 
-// 消费 Server-Sent Events 流
-func consumeSSEStream(url string) error {
+// 消费 Server-Sent Events 流，连接断开时自动重连，直到收到 close 事件
+func consumeSSEStream(ctx context.Context, url string) error {
 	fmt.Printf("🔄 开始消费 SSE 流: %s\n", url)
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("服务器返回错误状态: %d", resp.StatusCode)
-	}
-
-	scanner := bufio.NewScanner(resp.Body)
-	var eventID string
-	var eventType string
-	var eventData string
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if line == "" {
-			// 空行表示一个事件结束
-			if eventData != "" {
-				fmt.Printf("📡 SSE事件 [ID:%s, Type:%s]: %s\n", eventID, eventType, eventData)
-
-				// 尝试解析 JSON 数据
-				if eventData != "Connected to SSE stream" && eventData != "Stream ended" {
-					var jsonData map[string]interface{}
-					if err := json.Unmarshal([]byte(eventData), &jsonData); err == nil {
-						fmt.Printf("   解析后的数据: %+v\n", jsonData)
-					}
-				}
+	client := &streamclient.SSEClient{
+		URL: url,
+		OnStateChange: func(state streamclient.ConnState, err error) {
+			if err != nil {
+				fmt.Printf("🔌 连接状态: %s (%v)\n", state, err)
+				return
 			}
+			fmt.Printf("🔌 连接状态: %s\n", state)
+		},
+	}
 
-			// 重置事件字段
-			eventID = ""
-			eventType = ""
-			eventData = ""
-			continue
-		}
+	err := client.Run(ctx, func(event streamclient.Event) error {
+		fmt.Printf("📡 SSE事件 [ID:%s, Type:%s]: %s\n", event.ID, event.Type, event.Data)
 
-		if len(line) > 5 {
-			prefix := line[:5]
-			value := line[5:]
-
-			switch prefix {
-			case "id: ":
-				eventID = value
-			case "event":
-				if len(line) > 7 && line[:7] == "event: " {
-					eventType = line[7:]
-				}
-			case "data:":
-				if len(line) > 6 && line[:6] == "data: " {
-					eventData = line[6:]
-				}
-			}
+		// 尝试解析 JSON 数据
+		var jsonData map[string]interface{}
+		if err := json.Unmarshal([]byte(event.Data), &jsonData); err == nil {
+			fmt.Printf("   解析后的数据: %+v\n", jsonData)
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("读取 SSE 流时出错: %v", err)
 	}
 
-	fmt.Println("✅ SSE 流处理完成\n")
+	fmt.Print("✅ SSE 流处理完成\n\n")
 	return nil
 }
 
 // 演示逐字节读取流式响应
-func consumeStreamByteByByte(url string) error {
+func consumeStreamByteByByte(ctx context.Context, url string) error {
 	fmt.Printf("🔄 开始逐字节消费流: %s\n", url)
 
-	resp, err := http.Get(url)
+	resp, err := get(ctx, url)
 	if err != nil {
 		return fmt.Errorf("请求失败: %v", err)
 	}
@@ -201,7 +150,34 @@ func consumeStreamByteByByte(url string) error {
 	return nil
 }
 
+// get 发起一个可以通过 ctx 取消的 GET 请求
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
 func main() {
+	// 子命令：record 录制一个实时流，bench 对流式端点压测
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "record":
+			run = runRecord
+		case "bench":
+			run = runBench
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Printf("❌ 错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	baseURL := "http://localhost:8080"
 
 	fmt.Println("🚀 Go Streamable HTTP Client Demo")
@@ -213,10 +189,14 @@ func main() {
 	fmt.Print("按 Enter 键开始测试客户端...")
 	fmt.Scanln()
 
+	// 按 Ctrl+C 取消正在进行的流
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	// 测试不同类型的流式响应
 	tests := []struct {
 		name string
-		fn   func(string) error
+		fn   func(context.Context, string) error
 		url  string
 	}{
 		{
@@ -232,7 +212,7 @@ func main() {
 		{
 			name: "Server-Sent Events",
 			fn:   consumeSSEStream,
-			url:  baseURL + "/sse",
+			url:  baseURL + "/sse?limit=15",
 		},
 		{
 			name: "逐字节读取流",
@@ -242,10 +222,14 @@ func main() {
 	}
 
 	for i, test := range tests {
+		if ctx.Err() != nil {
+			break
+		}
+
 		fmt.Printf("\n%d. 测试 %s\n", i+1, test.name)
 		fmt.Println(strings.Repeat("-", 50))
 
-		if err := test.fn(test.url); err != nil {
+		if err := test.fn(ctx, test.url); err != nil {
 			fmt.Printf("❌ 错误: %v\n", err)
 		}
 
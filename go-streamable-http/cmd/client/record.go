@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"go-streamable-http/recording"
+)
+
+// runRecord 实现 record 子命令：把一个实时流连同消息的到达时间录制到文件，
+// 之后可以用服务器的 -replay 参数重放
+func runRecord(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:8080/stream/json?count=5", "要录制的流地址")
+	out := fs.String("out", "stream.rec", "录制文件路径")
+	kind := fs.String("kind", "", "流类型 ndjson、text 或 sse，默认根据 Content-Type 判断")
+	duration := fs.Duration("duration", 0, "最长录制时间，0 表示录制到流结束或按 Ctrl+C")
+	fs.Parse(args)
+
+	if *kind != "" {
+		if _, err := recording.ParseKind(*kind); err != nil {
+			return fmt.Errorf("-kind 必须是 ndjson、text 或 sse: %q", *kind)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *url, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务器返回错误状态: %d", resp.StatusCode)
+	}
+
+	header := recording.Header{
+		Kind:        recording.Kind(*kind),
+		URL:         *url,
+		ContentType: resp.Header.Get("Content-Type"),
+		RecordedAt:  time.Now(),
+	}
+	if header.Kind == "" {
+		header.Kind = recording.KindFromContentType(header.ContentType)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("创建录制文件失败: %v", err)
+	}
+	defer f.Close()
+
+	fmt.Printf("🔴 开始录制 %s 流: %s -> %s\n", header.Kind, *url, *out)
+	count, err := recording.Record(ctx, f, resp.Body, header)
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("录制失败（已录制 %d 条消息）: %v", count, err)
+	}
+
+	fmt.Printf("✅ 录制完成，共 %d 条消息\n", count)
+	fmt.Printf("💡 重放: 在服务器目录运行 go run . -replay %s [-replay-speed 2]，然后访问 /replay\n", *out)
+	return nil
+}
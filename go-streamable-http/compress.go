@@ -0,0 +1,129 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// flushWriteCloser 是 gzip.Writer 和 zlib.Writer 的共同行为
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compress 根据 Accept-Encoding 协商 gzip 或 deflate 压缩响应。
+// 每次处理器调用 Flush 时会先刷新压缩器，保证已写出的消息可以立即被客户端解压，
+// 因此流式响应在压缩后仍然是实时的。
+func compress(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next(cw, r)
+	}
+}
+
+// negotiateEncoding 从 Accept-Encoding 中选出支持的编码，优先 gzip，q=0 表示不接受
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = v
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[encoding]; ok || (!listed && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressWriter 在响应状态为 200 时压缩响应体，其他状态（如错误信息）原样输出
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	zw          flushWriteCloser
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status == http.StatusOK && w.Header().Get("Content-Encoding") == "" {
+		w.Header().Set("Content-Encoding", w.encoding)
+		w.Header().Del("Content-Length")
+
+		switch w.encoding {
+		case "gzip":
+			w.zw = gzip.NewWriter(w.ResponseWriter)
+		case "deflate":
+			// HTTP 的 deflate 编码是 zlib 格式（RFC 9110 第 8.4.1.2 节），不是裸 DEFLATE 数据
+			w.zw = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.zw == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.zw.Write(p)
+}
+
+// Flush 先把压缩器中缓存的数据写出，再刷新底层连接
+func (w *compressWriter) Flush() {
+	if w.zw != nil {
+		if err := w.zw.Flush(); err != nil {
+			log.Printf("Error flushing %s writer: %v", w.encoding, err)
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close 写出压缩流的结尾
+func (w *compressWriter) close() {
+	if w.zw == nil {
+		return
+	}
+	if err := w.zw.Close(); err != nil {
+		log.Printf("Error closing %s writer: %v", w.encoding, err)
+	}
+}
+
+// Unwrap 让 http.ResponseController 可以访问底层的 ResponseWriter
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
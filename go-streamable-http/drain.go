@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-streamable-http/websocket"
+)
+
+// 服务器开始关闭时 draining 被关闭，正在进行的流据此发送结束标记并尽快返回
+var (
+	draining  = make(chan struct{})
+	drainOnce sync.Once
+)
+
+// startDraining 通知所有流服务器即将关闭，可以重复调用
+func startDraining() {
+	drainOnce.Do(func() { close(draining) })
+}
+
+// isDraining 报告服务器是否已经开始关闭
+func isDraining() bool {
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeSSEShutdown 在服务器关闭时结束 SSE 流。close 事件带有 retry 字段，与流正常结束时的
+// close 事件区分开：客户端应在 retry 之后携带 Last-Event-ID 重连，由新的服务器实例继续。
+func writeSSEShutdown(w http.ResponseWriter) error {
+	if _, err := fmt.Fprintf(w, "retry: %d\n", sseRetry.Milliseconds()); err != nil {
+		return err
+	}
+	return writeSSEEvent(w, "", "close", "Server shutting down")
+}
+
+// rejectIfDraining 在服务器关闭期间拒绝新的流，返回 true 表示请求已被拒绝
+func rejectIfDraining(w http.ResponseWriter) bool {
+	if !isDraining() {
+		return false
+	}
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+	return true
+}
+
+// hijacked 记录已经升级为 WebSocket 的连接。Hijack 之后连接不再由 http.Server 管理，
+// Shutdown 既不会等待也不会关闭它们，所以关闭服务器时需要单独等待
+var hijacked = &connSet{conns: make(map[*websocket.Conn]struct{})}
+
+// connSet 是一组正在使用的 WebSocket 连接
+type connSet struct {
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+// track 记录 c，直到它被关闭。需要在升级后、开始读写之前调用
+func (s *connSet) track(c *websocket.Conn) {
+	c.OnClose = func() { s.remove(c) }
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c] = struct{}{}
+}
+
+func (s *connSet) remove(c *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+// snapshot 返回当前所有连接
+func (s *connSet) snapshot() []*websocket.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := make([]*websocket.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// wait 与 http.Server.Shutdown 一样轮询等待所有连接关闭。ctx 结束时向剩余连接发送 1001 关闭帧
+// 并关闭它们，返回被强制关闭的连接数。
+func (s *connSet) wait(ctx context.Context) int {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		conns := s.snapshot()
+		if len(conns) == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			for _, c := range conns {
+				c.Close(websocket.CloseGoingAway, "server shutting down")
+			}
+			return len(conns)
+		case <-ticker.C:
+		}
+	}
+}
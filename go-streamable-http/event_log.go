@@ -0,0 +1,182 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 每个事件日志最多保留的事件数，超出后丢弃最旧的事件
+const maxLoggedEvents = 1000
+
+// 最多保留的已过期主题记录数，超出后合并为一个全局水位
+const maxExpiredTopics = 10000
+
+// sseEvent 表示一条已经发送过的 SSE 事件，断线重连时按 Seq 重放
+type sseEvent struct {
+	Seq   uint64
+	Event string
+	Data  string
+	At    time.Time // 发布时间，超过保留时间后从日志中丢弃
+}
+
+// eventLog 记录单个主题已发布的事件
+type eventLog struct {
+	mu      sync.Mutex
+	events  []sseEvent
+	trimmed uint64    // 已经从日志中丢弃的最新事件序号
+	updated time.Time // 创建或最近一次写入的时间
+}
+
+// append 把一条事件写入日志
+func (l *eventLog) append(ev sseEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, ev)
+	if n := len(l.events) - maxLoggedEvents; n > 0 {
+		l.trimmed = l.events[n-1].Seq
+		l.events = l.events[n:]
+	}
+	l.updated = ev.At
+}
+
+// dropBefore 丢弃发布时间早于 cutoff 的事件
+func (l *eventLog) dropBefore(cutoff time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for n < len(l.events) && l.events[n].At.Before(cutoff) {
+		n++
+	}
+	if n > 0 {
+		l.trimmed = l.events[n-1].Seq
+		l.events = l.events[n:]
+	}
+}
+
+// since 返回序号大于 seq 的全部事件。seq 之后的事件已有部分被丢弃时 complete 为 false
+func (l *eventLog) since(seq uint64) (events []sseEvent, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	complete = seq >= l.trimmed
+	for i, ev := range l.events {
+		if ev.Seq > seq {
+			return append([]sseEvent(nil), l.events[i:]...), complete
+		}
+	}
+	return nil, complete
+}
+
+// last 返回日志中最新事件的序号，包括已经丢弃的事件
+func (l *eventLog) last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == 0 {
+		return l.trimmed
+	}
+	return l.events[len(l.events)-1].Seq
+}
+
+// eventLogStore 按主题管理事件日志。每个事件按发布时间计算，超过保留时间后被丢弃，
+// 读取日志不会延长保留时间；事件都已丢弃且超过保留时间没有新事件的日志会被删除。
+// 删除时记下该主题丢失的最新事件序号，之后从更早的位置恢复的客户端能够知道中间有缺口。
+type eventLogStore struct {
+	mu   sync.Mutex
+	logs map[string]*eventLog
+	ttl  time.Duration
+	// expired 记录已清理主题丢失的最新事件序号
+	expired map[string]uint64
+	// forgotten 是 expired 超出上限后合并得到的全局水位，对所有主题生效
+	forgotten uint64
+}
+
+func newEventLogStore(ttl time.Duration) *eventLogStore {
+	return &eventLogStore{
+		logs:    make(map[string]*eventLog),
+		ttl:     ttl,
+		expired: make(map[string]uint64),
+	}
+}
+
+// getOrCreate 返回指定 key 的事件日志，不存在时新建
+func (s *eventLogStore) getOrCreate(key string) *eventLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.logs[key]
+	if !ok {
+		// 重新创建的日志继承之前清理时丢失的位置
+		l = &eventLog{trimmed: s.expired[key], updated: time.Now()}
+		delete(s.expired, key)
+		s.logs[key] = l
+	}
+	return l
+}
+
+// since 返回指定 key 中序号大于 seq、且仍在保留时间内的事件。seq 之后的事件因日志截断
+// 或过期已有部分丢失时 complete 为 false
+func (s *eventLogStore) since(key string, seq uint64) (events []sseEvent, complete bool) {
+	s.mu.Lock()
+	l, ok := s.logs[key]
+	complete = seq >= s.forgotten && seq >= s.expired[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, complete
+	}
+	l.dropBefore(time.Now().Add(-s.ttl))
+	events, logComplete := l.since(seq)
+	return events, complete && logComplete
+}
+
+// expire 丢弃所有日志中超过保留时间的事件，并删除已经没有事件、且超过保留时间
+// 没有写入的日志，返回删除的日志数量
+func (s *eventLogStore) expire(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for id, l := range s.logs {
+		l.dropBefore(now.Add(-s.ttl))
+		l.mu.Lock()
+		stale := len(l.events) == 0 && now.Sub(l.updated) > s.ttl
+		l.mu.Unlock()
+		if stale {
+			delete(s.logs, id)
+			if last := l.last(); last > 0 {
+				s.expired[id] = last
+			}
+			removed++
+		}
+	}
+
+	if len(s.expired) > maxExpiredTopics {
+		for _, last := range s.expired {
+			s.forgotten = max(s.forgotten, last)
+		}
+		clear(s.expired)
+	}
+	return removed
+}
+
+// expireLoop 周期性清理过期的事件和日志，直到 stop 被关闭
+func (s *eventLogStore) expireLoop(stop <-chan struct{}) {
+	interval := s.ttl / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.expire(now)
+		}
+	}
+}
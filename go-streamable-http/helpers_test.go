@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 单个步骤的最长等待时间。处理器没有刷新数据时，读取会一直阻塞到这个时间
+const testTimeout = 5 * time.Second
+
+// manualTicker 是由测试触发的 streamTicker
+type manualTicker struct {
+	c        chan time.Time
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func (t *manualTicker) C() <-chan time.Time { return t.c }
+func (t *manualTicker) Reset(time.Duration) {}
+func (t *manualTicker) Stop()               { t.stopOnce.Do(func() { close(t.stopped) }) }
+
+// tick 触发一次 tick。通道没有缓冲，所以 tick 返回时处理器一定已经在等待下一条消息，
+// 在此之前客户端读到的消息都是处理器在等待之前刷新的。
+func (t *manualTicker) tick(tb testing.TB) {
+	tb.Helper()
+	select {
+	case t.c <- time.Now():
+	case <-t.stopped:
+		tb.Fatal("tick on a stopped ticker")
+	case <-time.After(testTimeout):
+		tb.Fatal("handler never waited for the next tick")
+	}
+}
+
+// manualClock 收集处理器创建的 manualTicker
+type manualClock struct {
+	tickers chan *manualTicker
+}
+
+// useDraining 在测试期间使用新的 draining 通道，测试可以调用 startDraining 而不影响其他测试。
+// 需要在启动测试服务器之前调用，让服务器先于恢复原状关闭。
+func useDraining(t *testing.T) {
+	t.Helper()
+	draining = make(chan struct{})
+	drainOnce = sync.Once{}
+	t.Cleanup(func() {
+		draining = make(chan struct{})
+		drainOnce = sync.Once{}
+	})
+}
+
+// useManualTicker 在测试期间用 manualTicker 替换 newStreamTicker
+func useManualTicker(t *testing.T) *manualClock {
+	t.Helper()
+	clock := &manualClock{tickers: make(chan *manualTicker, 16)}
+	orig := newStreamTicker
+	newStreamTicker = func(time.Duration) streamTicker {
+		tk := &manualTicker{c: make(chan time.Time), stopped: make(chan struct{})}
+		clock.tickers <- tk
+		return tk
+	}
+	t.Cleanup(func() { newStreamTicker = orig })
+	return clock
+}
+
+// next 返回处理器创建的下一个 ticker
+func (c *manualClock) next(t *testing.T) *manualTicker {
+	t.Helper()
+	select {
+	case tk := <-c.tickers:
+		return tk
+	case <-time.After(testTimeout):
+		t.Fatal("handler never created a ticker")
+		return nil
+	}
+}
+
+// newTestServer 启动一个只运行 h 的测试服务器，测试结束时关闭。
+// 需要 useManualTicker 时应先调用它，保证服务器先于 newStreamTicker 恢复之前关闭。
+func newTestServer(t *testing.T, h http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testClient 的超时保证没有刷新的消息会让测试失败而不是挂起
+var testClient = &http.Client{Timeout: testTimeout}
+
+// get 请求 url 并检查状态码为 200
+func get(t *testing.T, url string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := testClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("GET %s: status %d: %s", url, resp.StatusCode, body)
+	}
+	return resp
+}
+
+// bodyReader 按 Content-Encoding 解压响应体，并检查编码与期望一致
+func bodyReader(t *testing.T, resp *http.Response, wantEncoding string) *bufio.Reader {
+	t.Helper()
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding != wantEncoding {
+		t.Fatalf("Content-Encoding = %q, want %q", encoding, wantEncoding)
+	}
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("gzip header: %v", err)
+		}
+		return bufio.NewReader(zr)
+	case "deflate":
+		// HTTP 的 deflate 是 zlib 格式，裸 DEFLATE 数据在这里会因为缺少 zlib 头而失败
+		zr, err := zlib.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("zlib header: %v", err)
+		}
+		return bufio.NewReader(zr)
+	default:
+		return bufio.NewReader(resp.Body)
+	}
+}
+
+// readLine 读取一行（不含换行符），换行符之前遇到 EOF 视为帧错误
+func readLine(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read line: %v (partial %q)", err, line)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// expectEOF 检查响应已经结束
+func expectEOF(t *testing.T, br *bufio.Reader) {
+	t.Helper()
+	rest, err := io.ReadAll(br)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("read to end: %v", err)
+	}
+	if len(rest) > 0 {
+		t.Fatalf("unexpected data after end of stream: %q", rest)
+	}
+}
+
+// readSSEBlock 读取一个以空行结尾的 SSE 事件块，返回不含空行的各行
+func readSSEBlock(t *testing.T, br *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line := readLine(t, br)
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+var endpointSeq atomic.Int64
+
+// testEndpoint 返回一个唯一的端点名称，避免全局指标在 -count 多次运行时累积
+func testEndpoint(t *testing.T) string {
+	return fmt.Sprintf("/test/%s/%d", t.Name(), endpointSeq.Add(1))
+}
@@ -0,0 +1,46 @@
+// Package histogram 实现以 Prometheus 文本格式输出的固定桶直方图。
+// go-streamable-http 的刷新耗时和 json-rpc-demo 的方法耗时都使用它。
+package histogram
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Histogram 记录耗时分布。它本身不加锁，由调用方负责同步。
+type Histogram struct {
+	buckets []float64 // 升序的桶上界（秒）
+	counts  []uint64  // 与 buckets 一一对应，最后一个是 +Inf
+	sum     float64
+	total   uint64
+}
+
+// New 返回使用给定桶上界（秒，升序）的空直方图
+func New(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+// Observe 记录一次耗时
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	h.counts[sort.SearchFloat64s(h.buckets, seconds)]++
+	h.sum += seconds
+	h.total++
+}
+
+// AppendText 把 name 的 _bucket、_sum 和 _count 行追加到 out。
+// labels 是已经格式化好的标签，例如 `endpoint="/sse"`，le 标签会追加在它后面。
+func (h *Histogram) AppendText(out []byte, name, labels string) []byte {
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		out = fmt.Appendf(out, "%s_bucket{%s,le=%q} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += h.counts[len(h.buckets)]
+	out = fmt.Appendf(out, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, cumulative)
+	out = fmt.Appendf(out, "%s_sum{%s} %g\n", name, labels, h.sum)
+	out = fmt.Appendf(out, "%s_count{%s} %d\n", name, labels, h.total)
+	return out
+}
@@ -0,0 +1,24 @@
+package histogram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := New([]float64{0.001, 0.1})
+	h.Observe(500 * time.Microsecond)
+	h.Observe(time.Millisecond) // 桶上界是闭区间
+	h.Observe(50 * time.Millisecond)
+	h.Observe(time.Second)
+
+	want := `d_bucket{k="v",le="0.001"} 2
+d_bucket{k="v",le="0.1"} 3
+d_bucket{k="v",le="+Inf"} 4
+d_sum{k="v"} 1.0515
+d_count{k="v"} 4
+`
+	if got := string(h.AppendText([]byte(nil), "d", `k="v"`)); got != want {
+		t.Errorf("AppendText =\n%s\nwant\n%s", got, want)
+	}
+}
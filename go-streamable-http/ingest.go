@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// 上传的 NDJSON 中单行的最大长度
+const maxIngestLine = 1 << 20
+
+// ingestAck 是 /ingest 为每一行返回的确认
+type ingestAck struct {
+	Line  int    `json:"line"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ingestSummary 是 /ingest 响应的最后一行
+type ingestSummary struct {
+	Done     bool   `json:"done"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NDJSON 上传处理器：逐行读取请求体，校验每一行是否符合 StreamData 结构，
+// 并在同一个响应中以 NDJSON 逐行返回确认，无需把整个文件读入内存。
+func ingestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "ingest endpoint only accepts POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	if rejectIfDraining(w) {
+		return
+	}
+
+	// HTTP/1.1 默认在开始写响应后不再允许读取请求体，这里开启全双工，
+	// 使确认可以边读边写；HTTP/2 本身就是全双工，会返回不支持的错误，忽略即可。
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil && r.ProtoMajor < 2 {
+		log.Printf("Cannot enable full duplex for ingest: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxIngestLine)
+
+	summary := ingestSummary{Done: true}
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		ack := ingestAck{Line: line, OK: true}
+		if err := validateStreamData(raw); err != nil {
+			ack.OK = false
+			ack.Error = err.Error()
+			summary.Rejected++
+		} else {
+			summary.Accepted++
+		}
+
+		if err := writeJSONLine(w, ack); err != nil {
+			log.Printf("Ingest client went away after %d lines: %v", line, err)
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			summary.Error = fmt.Sprintf("line %d exceeds %d bytes", line+1, maxIngestLine)
+		} else {
+			summary.Error = fmt.Sprintf("read request body: %v", err)
+		}
+	}
+
+	if err := writeJSONLine(w, summary); err != nil {
+		log.Printf("Error writing ingest summary: %v", err)
+		return
+	}
+	log.Printf("Ingest finished: %d accepted, %d rejected", summary.Accepted, summary.Rejected)
+}
+
+// validateStreamData 严格校验一行 JSON：必须是对象，timestamp、message、count 三个字段都必须存在且类型正确，
+// 不允许出现其他字段
+func validateStreamData(raw []byte) error {
+	var fields struct {
+		Timestamp *int64  `json:"timestamp"`
+		Message   *string `json:"message"`
+		Count     *int    `json:"count"`
+		Final     bool    `json:"final"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fields); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			if typeErr.Field == "" {
+				return errors.New("line must be a JSON object")
+			}
+			return fmt.Errorf("field %q must be %s", typeErr.Field, typeErr.Type)
+		}
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if dec.More() {
+		return errors.New("invalid JSON: multiple values on one line")
+	}
+
+	var missing []string
+	if fields.Timestamp == nil {
+		missing = append(missing, "timestamp")
+	}
+	if fields.Message == nil {
+		missing = append(missing, "message")
+	}
+	if fields.Count == nil {
+		missing = append(missing, "count")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
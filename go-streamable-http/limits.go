@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 超过限制时建议客户端等待的时间
+const limitRetryAfter = 5 * time.Second
+
+// 拒绝原因，同时作为 stream_rejected_total 指标的 reason 标签
+const (
+	rejectCount     = "count"
+	rejectPerClient = "per_client"
+	rejectGlobal    = "global"
+)
+
+// streamLimiter 限制 count 参数的最大值、每个客户端 IP 的并发流数量和全局并发流数量，
+// 各项限制为 0 时表示不限制
+type streamLimiter struct {
+	maxCount     int
+	maxPerClient int
+	maxTotal     int
+
+	mu        sync.Mutex
+	perClient map[string]int
+	total     int
+}
+
+var limiter = newStreamLimiter(1000, 10, 1000)
+
+func newStreamLimiter(maxCount, maxPerClient, maxTotal int) *streamLimiter {
+	return &streamLimiter{
+		maxCount:     maxCount,
+		maxPerClient: maxPerClient,
+		maxTotal:     maxTotal,
+		perClient:    make(map[string]int),
+	}
+}
+
+// countAllowed 报告 count 参数是否在限制之内，无法解析的 count 交给处理器使用默认值
+func (l *streamLimiter) countAllowed(countParam string) bool {
+	if l.maxCount <= 0 || countParam == "" {
+		return true
+	}
+	c, err := strconv.Atoi(countParam)
+	return err != nil || c <= l.maxCount
+}
+
+// acquire 为客户端占用一个流名额，成功时返回释放函数，失败时返回拒绝原因
+func (l *streamLimiter) acquire(client string) (func(), string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return nil, rejectGlobal
+	}
+	if l.maxPerClient > 0 && l.perClient[client] >= l.maxPerClient {
+		return nil, rejectPerClient
+	}
+	l.total++
+	l.perClient[client]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(client) })
+	}, ""
+}
+
+func (l *streamLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	if l.perClient[client]--; l.perClient[client] <= 0 {
+		delete(l.perClient, client)
+	}
+}
+
+// limitStreams 在进入处理器之前检查 count 参数和并发流数量，超过限制时返回 429
+func limitStreams(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.countAllowed(r.URL.Query().Get("count")) {
+			rejectOverLimit(w, endpoint, rejectCount, fmt.Sprintf("count must not exceed %d", limiter.maxCount))
+			return
+		}
+
+		release, reason := limiter.acquire(clientIP(r))
+		if release == nil {
+			rejectOverLimit(w, endpoint, reason, limitMessage(reason))
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
+
+// limitMessage 返回并发流超过限制时给客户端的说明
+func limitMessage(reason string) string {
+	if reason == rejectGlobal {
+		return "server stream capacity reached"
+	}
+	return "too many concurrent streams from this client"
+}
+
+// rejectOverLimit 返回 429 并记录拒绝原因
+func rejectOverLimit(w http.ResponseWriter, endpoint, reason, message string) {
+	metrics.streamRejected(endpoint, reason)
+	w.Header().Set("Retry-After", strconv.Itoa(int(limitRetryAfter.Seconds())))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// clientIP 返回请求的对端 IP。X-Forwarded-For 可以被客户端伪造，这里不予采信
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
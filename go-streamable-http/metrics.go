@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go-streamable-http/histogram"
+)
+
+// 刷新耗时直方图的桶边界（秒）
+var flushLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// endpointMetrics 记录单个流式端点的指标
+type endpointMetrics struct {
+	openStreams  int64
+	streamsTotal uint64
+	bytesFlushed uint64
+	flushLatency *histogram.Histogram
+	rejected     map[string]uint64 // 按拒绝原因统计被限流拒绝的请求
+}
+
+// streamMetrics 按端点汇总指标，以 Prometheus 文本格式输出
+type streamMetrics struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointMetrics
+}
+
+var metrics = &streamMetrics{endpoints: make(map[string]*endpointMetrics)}
+
+// endpoint 返回指定端点的指标，调用方必须持有 m.mu
+func (m *streamMetrics) endpoint(name string) *endpointMetrics {
+	e, ok := m.endpoints[name]
+	if !ok {
+		e = &endpointMetrics{
+			flushLatency: histogram.New(flushLatencyBuckets),
+			rejected:     make(map[string]uint64),
+		}
+		m.endpoints[name] = e
+	}
+	return e
+}
+
+func (m *streamMetrics) streamOpened(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.endpoint(name)
+	e.openStreams++
+	e.streamsTotal++
+}
+
+func (m *streamMetrics) streamClosed(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpoint(name).openStreams--
+}
+
+func (m *streamMetrics) addBytes(name string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpoint(name).bytesFlushed += uint64(n)
+}
+
+func (m *streamMetrics) observeFlush(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.endpoint(name).flushLatency.Observe(d)
+}
+
+func (m *streamMetrics) streamRejected(name, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpoint(name).rejected[reason]++
+}
+
+// writeTo 以 Prometheus 文本格式输出所有指标
+func (m *streamMetrics) writeTo(w http.ResponseWriter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.endpoints))
+	for name := range m.endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []byte
+	printf := func(format string, args ...interface{}) {
+		out = fmt.Appendf(out, format, args...)
+	}
+
+	printf("# HELP stream_open_streams Number of streams currently open.\n")
+	printf("# TYPE stream_open_streams gauge\n")
+	for _, name := range names {
+		printf("stream_open_streams{endpoint=%q} %d\n", name, m.endpoints[name].openStreams)
+	}
+
+	printf("# HELP stream_streams_total Number of streams started.\n")
+	printf("# TYPE stream_streams_total counter\n")
+	for _, name := range names {
+		printf("stream_streams_total{endpoint=%q} %d\n", name, m.endpoints[name].streamsTotal)
+	}
+
+	printf("# HELP stream_flushed_bytes_total Bytes written to clients by stream handlers.\n")
+	printf("# TYPE stream_flushed_bytes_total counter\n")
+	for _, name := range names {
+		printf("stream_flushed_bytes_total{endpoint=%q} %d\n", name, m.endpoints[name].bytesFlushed)
+	}
+
+	printf("# HELP stream_flush_duration_seconds Time spent flushing buffered stream data to the connection.\n")
+	printf("# TYPE stream_flush_duration_seconds histogram\n")
+	for _, name := range names {
+		out = m.endpoints[name].flushLatency.AppendText(out, "stream_flush_duration_seconds", fmt.Sprintf("endpoint=%q", name))
+	}
+
+	printf("# HELP stream_rejected_total Stream requests rejected by rate limits.\n")
+	printf("# TYPE stream_rejected_total counter\n")
+	for _, name := range names {
+		rejected := m.endpoints[name].rejected
+		reasons := make([]string, 0, len(rejected))
+		for reason := range rejected {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			printf("stream_rejected_total{endpoint=%q,reason=%q} %d\n", name, reason, rejected[reason])
+		}
+	}
+
+	_, err := w.Write(out)
+	return err
+}
+
+// 指标处理器
+func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.writeTo(w); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// instrument 为流式处理器记录打开的流数量、写出的字节数和每次刷新的耗时
+func instrument(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics.streamOpened(endpoint)
+		defer metrics.streamClosed(endpoint)
+
+		mw := &meteredWriter{ResponseWriter: w, endpoint: endpoint}
+		defer mw.finish()
+		next(mw, r)
+	}
+}
+
+// meteredWriter 统计写出的字节数，并在每次 Flush 时记录刷新耗时
+type meteredWriter struct {
+	http.ResponseWriter
+	endpoint string
+	pending  int
+}
+
+func (w *meteredWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.pending += n
+	return n, err
+}
+
+func (w *meteredWriter) Flush() {
+	flusher, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+
+	started := time.Now()
+	flusher.Flush()
+	metrics.observeFlush(w.endpoint, time.Since(started))
+	w.finish()
+}
+
+// finish 把尚未计入的字节数计入指标，处理器返回时服务器会自动刷新剩余数据
+func (w *meteredWriter) finish() {
+	if w.pending > 0 {
+		metrics.addBytes(w.endpoint, w.pending)
+		w.pending = 0
+	}
+}
+
+// Unwrap 让 http.ResponseController 可以访问底层的 ResponseWriter
+func (w *meteredWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 单个请求最多合并的上游数量
+const maxMuxSources = 8
+
+// 远程上游的地址由客户端提供。为了不让服务器被当作访问内网地址的代理（SSRF），
+// 默认不允许远程上游，只有 -mux-remote-hosts 列出的主机可以访问，重定向的目标同样需要在列表中
+var muxRemoteHosts map[string]bool
+
+// muxRemoteClient 用于请求远程上游，限制建立连接、等待响应头和整个上游的时长，
+// 避免缓慢的上游一直占用 goroutine；重定向时重新检查允许列表
+var muxRemoteClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+	CheckRedirect: checkMuxRedirect,
+	Timeout:       5 * time.Minute,
+}
+
+// 自定义上游名称的格式，名称同时作为 SSE 的事件类型
+var muxSourceName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// muxSource 是 /sse/mux 的一个上游
+type muxSource struct {
+	name  string
+	spec  string
+	count string // 本地流的 count 参数，需要和直接请求一样受 -max-count 限制
+	open  func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// muxMessage 是合并后要发送的一条 SSE 事件
+type muxMessage struct {
+	event string
+	data  string
+}
+
+// parseMuxSource 解析 source 参数，格式为 [name=]spec，spec 可以是：
+//   - json 或 json?count=5&interval=200ms：本服务器的 /stream/json
+//   - text 或 text?interval=100ms：本服务器的 /stream/text
+//   - http:// 或 https:// 开头的远程 NDJSON 地址
+//
+// 未指定 name 时，本地流使用 json/text，远程地址使用 url1、url2……
+func parseMuxSource(raw string, index int) (muxSource, error) {
+	src := muxSource{spec: raw}
+	if name, spec, ok := strings.Cut(raw, "="); ok && muxSourceName.MatchString(name) && spec != "" {
+		src.name, src.spec = name, spec
+	}
+
+	kind, query, _ := strings.Cut(src.spec, "?")
+	switch {
+	case kind == "json" || kind == "text":
+		handler := streamJSONHandler
+		if kind == "text" {
+			handler = streamTextHandler
+		}
+		target := "/stream/" + kind + "?" + query
+		if values, err := url.ParseQuery(query); err == nil {
+			src.count = values.Get("count")
+		}
+		src.open = func(ctx context.Context) (io.ReadCloser, error) {
+			return openLocalStream(ctx, handler, target)
+		}
+		if src.name == "" {
+			src.name = kind
+		}
+
+	case strings.HasPrefix(src.spec, "http://") || strings.HasPrefix(src.spec, "https://"):
+		u, err := url.Parse(src.spec)
+		if err != nil {
+			return muxSource{}, fmt.Errorf("invalid source URL %q: %v", src.spec, err)
+		}
+		if len(muxRemoteHosts) == 0 {
+			return muxSource{}, fmt.Errorf("remote sources are disabled on this server")
+		}
+		if !remoteHostAllowed(u) {
+			return muxSource{}, fmt.Errorf("remote host %q is not allowed", u.Host)
+		}
+		remote := src.spec
+		src.open = func(ctx context.Context) (io.ReadCloser, error) {
+			return openRemoteStream(ctx, remote)
+		}
+		if src.name == "" {
+			src.name = fmt.Sprintf("url%d", index+1)
+		}
+
+	default:
+		return muxSource{}, fmt.Errorf("unknown source %q", raw)
+	}
+
+	// error、done、close 是 /sse/mux 自身使用的事件类型
+	switch src.name {
+	case "error", "done", "close", "message":
+		return muxSource{}, fmt.Errorf("source name %q is reserved", src.name)
+	}
+	return src, nil
+}
+
+// 多路合并处理器：把多个上游流合并为一个 SSE 流，每个上游的消息使用自己的事件类型。
+// 上游出错时发送 error 事件而不是结束整个流，某个上游结束时发送 done 事件，
+// 全部上游结束后发送 close 事件。
+func muxHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfDraining(w) {
+		return
+	}
+
+	rawSources := r.URL.Query()["source"]
+	if len(rawSources) == 0 {
+		http.Error(w, "at least one source parameter is required", http.StatusBadRequest)
+		return
+	}
+	if len(rawSources) > maxMuxSources {
+		http.Error(w, fmt.Sprintf("at most %d sources are allowed", maxMuxSources), http.StatusBadRequest)
+		return
+	}
+
+	sources := make([]muxSource, 0, len(rawSources))
+	seen := make(map[string]bool)
+	for i, raw := range rawSources {
+		src, err := parseMuxSource(raw, i)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if seen[src.name] {
+			http.Error(w, fmt.Sprintf("duplicate source name %q", src.name), http.StatusBadRequest)
+			return
+		}
+		if !limiter.countAllowed(src.count) {
+			rejectOverLimit(w, "/sse/mux", rejectCount, fmt.Sprintf("count must not exceed %d", limiter.maxCount))
+			return
+		}
+		seen[src.name] = true
+		sources = append(sources, src)
+	}
+
+	// 每个上游和直接请求一样占用一个流名额，否则一个请求就可以绕过并发流限制
+	releases := make([]func(), 0, len(sources))
+	for range sources {
+		release, reason := limiter.acquire(clientIP(r))
+		if release == nil {
+			for _, release := range releases {
+				release()
+			}
+			rejectOverLimit(w, "/sse/mux", reason, limitMessage(reason))
+			return
+		}
+		releases = append(releases, release)
+	}
+
+	// 设置 SSE 响应头
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	messages := make(chan muxMessage, 16)
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(src muxSource, release func()) {
+			defer wg.Done()
+			defer release()
+			pumpMuxSource(ctx, src, messages)
+		}(src, releases[i])
+	}
+	go func() {
+		wg.Wait()
+		close(messages)
+	}()
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+		log.Printf("Error writing SSE message: %v", err)
+		return
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-draining:
+			if err := writeSSEShutdown(w); err != nil {
+				log.Printf("Error writing SSE close event: %v", err)
+			}
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				if err := writeSSEEvent(w, "", "close", "All sources finished"); err != nil {
+					log.Printf("Error writing SSE close event: %v", err)
+				}
+				return
+			}
+			if err := writeSSEEvent(w, "", msg.event, msg.data); err != nil {
+				log.Printf("Error writing multiplexed SSE event: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// pumpMuxSource 逐行读取一个上游并转发为事件，出错和结束时分别发送 error 和 done 事件
+func pumpMuxSource(ctx context.Context, src muxSource, messages chan<- muxMessage) {
+	send := func(msg muxMessage) bool {
+		select {
+		case messages <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	status := func(event string, fields map[string]interface{}) bool {
+		fields["source"] = src.name
+		data, _ := json.Marshal(fields)
+		return send(muxMessage{event: event, data: string(data)})
+	}
+
+	body, err := src.open(ctx)
+	if err != nil {
+		status("error", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	scanner.Split(scanAnyLines)
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		count++
+		if !send(muxMessage{event: src.name, data: line}) {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		status("error", map[string]interface{}{"error": err.Error(), "count": count})
+		return
+	}
+	status("done", map[string]interface{}{"count": count})
+}
+
+// scanAnyLines 与 bufio.ScanLines 类似，但和 SSE 规范一样把 CRLF、LF 和单独的 CR 都当作行尾。
+// 只按 LF 拆分时，上游数据中单独的 CR 会在合并后的流里开始新的一行，从而注入 event:、id: 等字段。
+func scanAnyLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF {
+				// 需要再读一个字节才能判断是不是 CRLF
+				return 0, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// openLocalStream 在进程内运行本服务器的流式处理器，通过管道读取它的输出
+func openLocalStream(ctx context.Context, handler http.HandlerFunc, target string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		handler(&pipeResponseWriter{header: make(http.Header), w: pw}, req)
+		pw.Close()
+	}()
+	return pr, nil
+}
+
+// openRemoteStream 请求一个远程 NDJSON 流
+func openRemoteStream(ctx context.Context, target string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-ndjson, application/json")
+
+	resp, err := muxRemoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// parseHostList 解析逗号分隔的主机列表，条目可以是 host 或 host:port
+func parseHostList(list string) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+	return hosts
+}
+
+// remoteHostAllowed 报告 u 的主机是否在允许列表中，不带端口的条目允许该主机的任意端口
+func remoteHostAllowed(u *url.URL) bool {
+	return muxRemoteHosts[strings.ToLower(u.Host)] || muxRemoteHosts[strings.ToLower(u.Hostname())]
+}
+
+// checkMuxRedirect 只跟随指向允许列表中主机的重定向
+func checkMuxRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if !remoteHostAllowed(req.URL) {
+		return fmt.Errorf("redirect to host %q is not allowed", req.URL.Host)
+	}
+	return nil
+}
+
+// pipeResponseWriter 把处理器写出的响应体写入管道
+type pipeResponseWriter struct {
+	header http.Header
+	w      io.Writer
+}
+
+func (p *pipeResponseWriter) Header() http.Header         { return p.header }
+func (p *pipeResponseWriter) Write(b []byte) (int, error) { return p.w.Write(b) }
+func (p *pipeResponseWriter) WriteHeader(int)             {}
+func (p *pipeResponseWriter) Flush()                      {}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 客户端通过 interval 参数可以设置的发送间隔范围
+const (
+	minStreamInterval = 10 * time.Millisecond
+	maxStreamInterval = time.Minute
+)
+
+// streamPacing 根据 interval 和 timeout 参数确定流的发送间隔和总截止时间。
+// 返回的 context 在客户端断开或超过截止时间时结束，调用方必须调用 cancel。
+func streamPacing(r *http.Request, defaultInterval time.Duration) (time.Duration, context.Context, context.CancelFunc) {
+	interval := defaultInterval
+	if d, ok := parseDurationParam(r, "interval"); ok {
+		interval = clampInterval(d)
+	}
+
+	if timeout, ok := parseDurationParam(r, "timeout"); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		return interval, ctx, cancel
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	return interval, ctx, cancel
+}
+
+// clampInterval 把发送间隔限制在 minStreamInterval 和 maxStreamInterval 之间
+func clampInterval(d time.Duration) time.Duration {
+	if d < minStreamInterval {
+		return minStreamInterval
+	}
+	if d > maxStreamInterval {
+		return maxStreamInterval
+	}
+	return d
+}
+
+// parseDurationParam 解析时长参数，参数缺失或无效时返回 false
+func parseDurationParam(r *http.Request, name string) (time.Duration, bool) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return 0, false
+	}
+	d, err := parseDuration(param)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// parseDuration 解析正的时长，支持 Go 时长格式（如 "250ms"）或纯数字的毫秒数
+func parseDuration(s string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(s); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid duration %q", s)
+}
+
+// logStreamStopped 记录提前结束的流已经发送了多少条数据，以及结束原因
+func logStreamStopped(ctx context.Context, name string, sent, total int) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("%s stream reached its deadline after delivering %d/%d items", name, sent, total)
+		return
+	}
+	log.Printf("%s stream client went away after delivering %d/%d items", name, sent, total)
+}
@@ -0,0 +1,194 @@
+// Package recording 把流式响应连同每条消息的到达时间录制到文件，并可以按原始节奏或 N 倍速重放，
+// 用于离线复现流式问题和对消费端进行可重复的测试。
+//
+// 录制文件本身是 NDJSON：第一行是 Header，之后每行一个 Entry。
+//
+//	{"kind":"sse","url":"http://localhost:8080/sse","content_type":"text/event-stream","recorded_at":"..."}
+//	{"offset_us":1520,"data":"retry: 3000\ndata: Connected to SSE stream\n\n"}
+//	{"offset_us":801234,"data":"id: 1\ndata: {...}\n\n"}
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"time"
+)
+
+// Kind 是录制的流类型，决定如何把字节流切分成消息
+type Kind string
+
+const (
+	// KindNDJSON 每行一个 JSON 对象
+	KindNDJSON Kind = "ndjson"
+	// KindText 每行一条文本
+	KindText Kind = "text"
+	// KindSSE 每个以空行结尾的事件块是一条消息
+	KindSSE Kind = "sse"
+)
+
+// ParseKind 校验 s 是否是已知的流类型
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(s); k {
+	case KindNDJSON, KindText, KindSSE:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown stream kind %q, want ndjson, text or sse", s)
+}
+
+// KindFromContentType 根据响应的 Content-Type 推断流类型
+func KindFromContentType(contentType string) Kind {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/event-stream":
+		return KindSSE
+	case "application/json", "application/x-ndjson", "application/jsonl":
+		return KindNDJSON
+	default:
+		return KindText
+	}
+}
+
+// Header 是录制文件的第一行，描述录制的来源
+type Header struct {
+	Kind        Kind      `json:"kind"`
+	URL         string    `json:"url,omitempty"`
+	ContentType string    `json:"content_type"`
+	RecordedAt  time.Time `json:"recorded_at"`
+}
+
+// Entry 是一条录制的消息，Data 保留原始的字节（包括换行符），OffsetUS 是相对流开始的微秒数
+type Entry struct {
+	OffsetUS int64  `json:"offset_us"`
+	Data     string `json:"data"`
+}
+
+// Offset 返回消息相对流开始的时间
+func (e Entry) Offset() time.Duration {
+	return time.Duration(e.OffsetUS) * time.Microsecond
+}
+
+// Recording 是加载到内存中的录制文件
+type Recording struct {
+	Header  Header
+	Entries []Entry
+}
+
+// Record 从 r 读取消息并连同到达时间写入 w，返回录制的消息数。
+// 读取结束时尚未完整的消息也会被录制。ctx 被取消时返回 ctx.Err()，
+// 调用方应保证 ctx 取消时 r 的读取会返回（例如使用带 ctx 的 HTTP 请求）。
+func Record(ctx context.Context, w io.Writer, r io.Reader, header Header) (int, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return 0, fmt.Errorf("write header: %w", err)
+	}
+
+	started := time.Now()
+	br := bufio.NewReader(r)
+	count := 0
+	for {
+		data, readErr := readMessage(br, header.Kind)
+		if data != "" {
+			entry := Entry{OffsetUS: time.Since(started).Microseconds(), Data: data}
+			if err := enc.Encode(entry); err != nil {
+				return count, fmt.Errorf("write entry: %w", err)
+			}
+			count++
+		}
+
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return count, ctx.Err()
+			}
+			if errors.Is(readErr, io.EOF) {
+				return count, nil
+			}
+			return count, fmt.Errorf("read stream: %w", readErr)
+		}
+	}
+}
+
+// readMessage 读取一条完整的消息：SSE 读到空行为止，其他类型读一行
+func readMessage(br *bufio.Reader, kind Kind) (string, error) {
+	if kind != KindSSE {
+		return br.ReadString('\n')
+	}
+
+	var message []byte
+	for {
+		line, err := br.ReadString('\n')
+		message = append(message, line...)
+		if err != nil {
+			return string(message), err
+		}
+		if line == "\n" || line == "\r\n" {
+			return string(message), nil
+		}
+	}
+}
+
+// Load 读取一个录制文件
+func Load(r io.Reader) (*Recording, error) {
+	dec := json.NewDecoder(r)
+
+	var rec Recording
+	if err := dec.Decode(&rec.Header); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if rec.Header.Kind == "" {
+		return nil, errors.New("read header: missing kind")
+	}
+	if _, err := ParseKind(string(rec.Header.Kind)); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	for {
+		var entry Entry
+		if err := dec.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				return &rec, nil
+			}
+			return nil, fmt.Errorf("read entry %d: %w", len(rec.Entries)+1, err)
+		}
+		rec.Entries = append(rec.Entries, entry)
+	}
+}
+
+// Replay 按录制时的节奏把消息写入 w，speed 为倍速（2 表示两倍速），必须大于 0。
+// 每写完一条消息调用一次 flush（可以为 nil）。ctx 结束时立即返回 ctx.Err()。
+func (rec *Recording) Replay(ctx context.Context, w io.Writer, speed float64, flush func()) error {
+	if speed <= 0 {
+		return fmt.Errorf("invalid replay speed %v", speed)
+	}
+
+	started := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for _, entry := range rec.Entries {
+		due := time.Duration(float64(entry.Offset()) / speed)
+		if wait := due - time.Since(started); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, entry.Data); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+	}
+	return nil
+}
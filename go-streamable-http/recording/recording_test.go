@@ -0,0 +1,202 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		kind  Kind
+		input string
+		want  []string
+	}{
+		{"ndjson lines", KindNDJSON, "{\"a\":1}\n{\"b\":2}\n", []string{"{\"a\":1}\n", "{\"b\":2}\n"}},
+		{"ndjson partial trailing line", KindNDJSON, "{\"a\":1}\n{\"b\"", []string{"{\"a\":1}\n", "{\"b\""}},
+		{"text keeps blank lines", KindText, "one\n\ntwo\n", []string{"one\n", "\n", "two\n"}},
+		{"sse blocks", KindSSE, "id: 1\ndata: a\n\nevent: close\ndata: b\n\n", []string{"id: 1\ndata: a\n\n", "event: close\ndata: b\n\n"}},
+		{"sse CRLF", KindSSE, "data: a\r\n\r\ndata: b\r\n\r\n", []string{"data: a\r\n\r\n", "data: b\r\n\r\n"}},
+		{"sse partial trailing block", KindSSE, "data: a\n\ndata: b\n", []string{"data: a\n\n", "data: b\n"}},
+		{"sse partial trailing line", KindSSE, "data: a\n\ndata: b", []string{"data: a\n\n", "data: b"}},
+		{"empty stream", KindSSE, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.input))
+			var got []string
+			for {
+				msg, err := readMessage(br, tt.kind)
+				if msg != "" {
+					got = append(got, msg)
+				}
+				if err != nil {
+					if err != io.EOF {
+						t.Fatalf("readMessage: %v", err)
+					}
+					break
+				}
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingReader 先返回 data，然后返回 err
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestRecord(t *testing.T) {
+	broken := errors.New("connection reset")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		input io.Reader
+		want  []string
+		err   error // nil 表示正常结束
+	}{
+		{
+			name:  "complete and partial messages",
+			ctx:   context.Background(),
+			input: strings.NewReader("data: a\n\ndata: b\n"),
+			want:  []string{"data: a\n\n", "data: b\n"},
+		},
+		{
+			name:  "read error keeps what arrived",
+			ctx:   context.Background(),
+			input: &failingReader{strings.NewReader("data: a\n\ndata: b"), broken},
+			want:  []string{"data: a\n\n", "data: b"},
+			err:   broken,
+		},
+		{
+			name:  "cancelled",
+			ctx:   cancelled,
+			input: strings.NewReader("data: a\n\n"),
+			want:  []string{"data: a\n\n"},
+			err:   context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := Header{Kind: KindSSE, URL: "http://example/sse", ContentType: "text/event-stream", RecordedAt: time.Unix(1, 0).UTC()}
+			var buf bytes.Buffer
+			count, err := Record(tt.ctx, &buf, tt.input, header)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Record = %v, want %v", err, tt.err)
+			}
+			if count != len(tt.want) {
+				t.Errorf("Record counted %d messages, want %d", count, len(tt.want))
+			}
+
+			// 录制结果可以原样加载
+			rec, err := Load(&buf)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if rec.Header != header {
+				t.Errorf("header = %+v, want %+v", rec.Header, header)
+			}
+			var got []string
+			var last time.Duration
+			for _, entry := range rec.Entries {
+				got = append(got, entry.Data)
+				if entry.Offset() < last {
+					t.Errorf("offsets go backwards: %v after %v", entry.Offset(), last)
+				}
+				last = entry.Offset()
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	const header = `{"kind":"ndjson","content_type":"application/json","recorded_at":"2024-01-01T00:00:00Z"}` + "\n"
+
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"empty file", "", "read header: EOF"},
+		{"invalid header", "not json\n", "read header"},
+		{"truncated header", `{"kind":"ndj`, "read header: unexpected EOF"},
+		{"missing kind", `{"content_type":"text/plain"}` + "\n", "read header: missing kind"},
+		{"unknown kind", `{"kind":"foo"}` + "\n", `read header: unknown stream kind "foo"`},
+		{"truncated entry", header + `{"offset_us":1,"data":"a\n"}` + "\n" + `{"offset_us":2,"da`, "read entry 2: unexpected EOF"},
+		{"invalid entry", header + `{"offset_us":"soon","data":"a"}` + "\n", "read entry 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := Load(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Load = %+v, %v, want error %q", rec, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for _, s := range []string{"ndjson", "text", "sse"} {
+		if k, err := ParseKind(s); err != nil || string(k) != s {
+			t.Errorf("ParseKind(%q) = %q, %v", s, k, err)
+		}
+	}
+	for _, s := range []string{"", "foo", "SSE"} {
+		if _, err := ParseKind(s); err == nil {
+			t.Errorf("ParseKind(%q) succeeded", s)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rec := &Recording{
+		Header:  Header{Kind: KindText},
+		Entries: []Entry{{OffsetUS: 0, Data: "a\n"}, {OffsetUS: 20000, Data: "b\n"}},
+	}
+
+	var buf bytes.Buffer
+	flushes := 0
+	started := time.Now()
+	if err := rec.Replay(context.Background(), &buf, 2, func() { flushes++ }); err != nil {
+		t.Fatal(err)
+	}
+	// 两倍速时第二条消息在 10ms 后写出
+	if elapsed := time.Since(started); elapsed < 10*time.Millisecond {
+		t.Errorf("replay took %v, want at least 10ms", elapsed)
+	}
+	if buf.String() != "a\nb\n" || flushes != 2 {
+		t.Errorf("replayed %q with %d flushes", buf.String(), flushes)
+	}
+
+	if err := rec.Replay(context.Background(), io.Discard, 0, nil); err == nil {
+		t.Error("Replay accepted speed 0")
+	}
+}
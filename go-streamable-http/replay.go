@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"go-streamable-http/recording"
+)
+
+// loadRecording 读取 -replay 指定的录制文件
+func loadRecording(path string) (*recording.Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return recording.Load(f)
+}
+
+// replayHandler 按录制时的节奏重放一个录制文件，speed 参数可以覆盖默认倍速
+func replayHandler(rec *recording.Recording, defaultSpeed float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rejectIfDraining(w) {
+			return
+		}
+
+		speed := defaultSpeed
+		if speedParam := r.URL.Query().Get("speed"); speedParam != "" {
+			s, err := strconv.ParseFloat(speedParam, 64)
+			if err != nil || s <= 0 {
+				http.Error(w, "speed must be a positive number", http.StatusBadRequest)
+				return
+			}
+			speed = s
+		}
+
+		w.Header().Set("Content-Type", rec.Header.ContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+
+		// 服务器关闭时和客户端断开一样结束重放
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-draining:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		flush := func() {
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		if err := rec.Replay(ctx, w, speed, flush); err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Printf("Replay of %s stopped early", rec.Header.URL)
+				return
+			}
+			log.Printf("Error replaying %s: %v", rec.Header.URL, err)
+			return
+		}
+		log.Printf("Replayed %d %s messages from %s at %gx", len(rec.Entries), rec.Header.Kind, rec.Header.URL, speed)
+	}
+}
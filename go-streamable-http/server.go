@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+
+	"go-streamable-http/recording"
 )
 
 // 流式 JSON 响应处理器
 func streamJSONHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfDraining(w) {
+		return
+	}
+
 	// 设置响应头以支持流式传输
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -29,45 +42,71 @@ func streamJSONHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 根据 interval 和 timeout 参数确定发送节奏
+	interval, ctx, cancel := streamPacing(r, 500*time.Millisecond)
+	defer cancel()
+
+	ticker := newStreamTicker(interval)
+	defer ticker.Stop()
+
 	// 流式发送数据
 	for i := 1; i <= count; i++ {
+		// 除第一条外，每条数据都等待下一个 tick，期间客户端断开或超时则立即结束
+		if i > 1 {
+			select {
+			case <-ctx.Done():
+				logStreamStopped(ctx, "JSON", i-1, count)
+				return
+			case <-draining:
+				// 服务器即将关闭，发送结束标记让客户端知道流不是意外中断
+				final := StreamData{Timestamp: time.Now().Unix(), Message: "server shutting down", Count: i - 1, Final: true}
+				if err := writeJSONLine(w, final); err != nil {
+					log.Printf("Error writing shutdown sentinel: %v", err)
+				}
+				log.Printf("JSON stream closed for shutdown after delivering %d/%d items", i-1, count)
+				return
+			case <-ticker.C():
+			}
+		}
+
 		data := StreamData{
 			Timestamp: time.Now().Unix(),
 			Message:   fmt.Sprintf("Stream message #%d", i),
 			Count:     i,
 		}
 
-		// 将数据编码为 JSON
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			log.Printf("Error marshaling JSON: %v", err)
-			return
-		}
-
-		// 写入响应
-		if _, err := w.Write(jsonData); err != nil {
-			log.Printf("Error writing response: %v", err)
+		if err := writeJSONLine(w, data); err != nil {
+			log.Printf("Error writing response after %d/%d items: %v", i-1, count, err)
 			return
 		}
+	}
+}
 
-		// 添加换行符分隔每个 JSON 对象
-		if _, err := w.Write([]byte("\n")); err != nil {
-			log.Printf("Error writing newline: %v", err)
-			return
-		}
+// writeJSONLine 写出一个 JSON 对象和换行符，并强制刷新缓冲区确保数据立即发送
+func writeJSONLine(w http.ResponseWriter, v interface{}) error {
+	// 将数据编码为 JSON
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
 
-		// 强制刷新缓冲区，确保数据立即发送
-		if flusher, ok := w.(http.Flusher); ok {
-			flusher.Flush()
-		}
+	// 添加换行符分隔每个 JSON 对象
+	if _, err := w.Write(append(jsonData, '\n')); err != nil {
+		return err
+	}
 
-		// 模拟处理时间
-		time.Sleep(500 * time.Millisecond)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
 	}
+	return nil
 }
 
 // 流式文本响应处理器
-func streamTextHandler(w http.ResponseWriter, _ *http.Request) {
+func streamTextHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfDraining(w) {
+		return
+	}
+
 	// 设置响应头
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -75,15 +114,41 @@ func streamTextHandler(w http.ResponseWriter, _ *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 
+	// 根据 interval 和 timeout 参数确定发送节奏
+	interval, ctx, cancel := streamPacing(r, 300*time.Millisecond)
+	defer cancel()
+
+	ticker := newStreamTicker(interval)
+	defer ticker.Stop()
+
 	// 流式发送文本数据
-	for i := 1; i <= 20; i++ {
+	const total = 20
+	for i := 1; i <= total; i++ {
+		if i > 1 {
+			select {
+			case <-ctx.Done():
+				logStreamStopped(ctx, "Text", i-1, total)
+				return
+			case <-draining:
+				if _, err := fmt.Fprint(w, "[server shutting down]\n"); err != nil {
+					log.Printf("Error writing shutdown notice: %v", err)
+				}
+				if flusher, ok := w.(http.Flusher); ok {
+					flusher.Flush()
+				}
+				log.Printf("Text stream closed for shutdown after delivering %d/%d lines", i-1, total)
+				return
+			case <-ticker.C():
+			}
+		}
+
 		message := fmt.Sprintf("[%s] Streaming line %d - Current time: %s\n",
 			time.Now().Format("15:04:05"),
 			i,
 			time.Now().Format("2006-01-02 15:04:05"))
 
 		if _, err := w.Write([]byte(message)); err != nil {
-			log.Printf("Error writing response: %v", err)
+			log.Printf("Error writing response after %d/%d lines: %v", i-1, total, err)
 			return
 		}
 
@@ -91,13 +156,53 @@ func streamTextHandler(w http.ResponseWriter, _ *http.Request) {
 		if flusher, ok := w.(http.Flusher); ok {
 			flusher.Flush()
 		}
-
-		time.Sleep(300 * time.Millisecond)
 	}
 }
 
-// Server-Sent Events (SSE) 处理器
-func sseHandler(w http.ResponseWriter, _ *http.Request) {
+// 未指定 topic 参数时订阅的默认主题，由 publishDemoEvents 持续发布示例事件
+const defaultTopic = "demo"
+
+// 发布接口允许的最大请求体大小
+const maxPublishBody = 64 << 10
+
+// SSE 相关配置，可通过命令行参数调整
+var (
+	// sseRetry 是发送给客户端的重连间隔提示
+	sseRetry = 3 * time.Second
+	// sseBroker 负责按主题分发事件，并保存事件日志用于 Last-Event-ID 重放
+	sseBroker = newBroker(newEventLogStore(5*time.Minute), policyDrop)
+)
+
+// Server-Sent Events (SSE) 处理器，订阅 topic 参数指定的主题（逗号分隔）
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfDraining(w) {
+		return
+	}
+
+	topics := parseTopics(r.URL.Query().Get("topic"))
+	if len(topics) == 0 {
+		topics = []string{defaultTopic}
+	}
+
+	// 可选的 limit 参数：收到指定数量的事件后发送结束事件
+	limit := 0
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	// 解析 Last-Event-ID，决定从哪个事件之后开始重放
+	var lastSeq uint64
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		seq, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring invalid Last-Event-ID %q", lastEventID)
+		} else {
+			lastSeq = seq
+		}
+	}
+
 	// 设置 SSE 响应头
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -106,8 +211,11 @@ func sseHandler(w http.ResponseWriter, _ *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 
-	// 发送初始连接消息
-	if _, err := fmt.Fprintf(w, "data: Connected to SSE stream\n\n"); err != nil {
+	sub, replay, complete := sseBroker.subscribe(topics, lastSeq)
+	defer sseBroker.unsubscribe(sub)
+
+	// 发送重连间隔提示和初始连接消息
+	if _, err := fmt.Fprintf(w, "retry: %d\ndata: Connected to SSE stream\n\n", sseRetry.Milliseconds()); err != nil {
 		log.Printf("Error writing SSE message: %v", err)
 		return
 	}
@@ -115,46 +223,174 @@ func sseHandler(w http.ResponseWriter, _ *http.Request) {
 		flusher.Flush()
 	}
 
-	// 持续发送事件
-	for i := 1; i <= 15; i++ {
-		event := map[string]interface{}{
-			"id":        i,
-			"timestamp": time.Now().Unix(),
-			"data":      fmt.Sprintf("SSE Event #%d", i),
-			"random":    time.Now().Nanosecond() % 1000,
-		}
-
-		jsonData, _ := json.Marshal(event)
+	sent := 0
+	send := func(ev sseEvent) error {
+		sent++
+		return writeSSEEvent(w, strconv.FormatUint(ev.Seq, 10), ev.Event, ev.Data)
+	}
 
-		// SSE 格式：data: {json}\n\n
-		if _, err := fmt.Fprintf(w, "id: %d\n", i); err != nil {
-			log.Printf("Error writing SSE id: %v", err)
+	// 重放客户端断线期间错过的事件。日志已经无法补齐时先发送 reset 事件，
+	// 告知客户端中间有事件丢失，需要自行重新同步状态
+	if lastSeq > 0 {
+		log.Printf("Replaying %d SSE events after %d for topics %v", len(replay), lastSeq, topics)
+	}
+	if !complete {
+		log.Printf("SSE events after %d are no longer available for topics %v, sending reset", lastSeq, topics)
+		if err := writeSSEEvent(w, "", "reset", fmt.Sprintf("Events after %d are no longer available", lastSeq)); err != nil {
+			log.Printf("Error writing SSE reset event: %v", err)
 			return
 		}
-		if _, err := fmt.Fprintf(w, "data: %s\n\n", jsonData); err != nil {
-			log.Printf("Error writing SSE data: %v", err)
+	}
+	for _, ev := range replay {
+		if limit > 0 && sent >= limit {
+			break
+		}
+		if err := send(ev); err != nil {
+			log.Printf("Error replaying SSE event: %v", err)
 			return
 		}
+	}
 
-		if flusher, ok := w.(http.Flusher); ok {
-			flusher.Flush()
+	// 持续转发订阅主题的实时事件，直到客户端断开
+	for limit == 0 || sent < limit {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-draining:
+			if err := writeSSEShutdown(w); err != nil {
+				log.Printf("Error writing SSE close event: %v", err)
+			}
+			return
+		case <-sub.kicked:
+			// 不发送 close 事件，直接结束响应，让客户端携带 Last-Event-ID 重连并从事件日志补齐
+			if _, err := fmt.Fprint(w, ": subscriber too slow, reconnect with Last-Event-ID\n\n"); err != nil {
+				log.Printf("Error writing SSE comment: %v", err)
+			}
+			return
+		case ev := <-sub.events:
+			if err := send(ev); err != nil {
+				log.Printf("Error writing SSE event: %v", err)
+				return
+			}
 		}
-
-		time.Sleep(800 * time.Millisecond)
 	}
 
 	// 发送结束事件
-	if _, err := fmt.Fprintf(w, "event: close\n"); err != nil {
+	if err := writeSSEEvent(w, "", "close", "Stream ended"); err != nil {
 		log.Printf("Error writing SSE close event: %v", err)
+	}
+}
+
+// 发布处理器：POST /publish/{topic}，请求体作为事件数据，可用 event 参数指定事件类型
+func publishHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "publish endpoint only accepts POST requests", http.StatusMethodNotAllowed)
 		return
 	}
-	if _, err := fmt.Fprintf(w, "data: Stream ended\n\n"); err != nil {
-		log.Printf("Error writing SSE close data: %v", err)
+
+	topic := strings.TrimPrefix(r.URL.Path, "/publish/")
+	if topic == "" || strings.ContainsAny(topic, ",/") {
+		http.Error(w, "invalid topic", http.StatusBadRequest)
+		return
+	}
+
+	event := r.URL.Query().Get("event")
+	if strings.ContainsAny(event, "\r\n") {
+		http.Error(w, "invalid event type", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPublishBody+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
 		return
 	}
+	if len(body) > maxPublishBody {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	seq, delivered := sseBroker.publish(topic, event, strings.TrimRight(string(body), "\r\n"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":          seq,
+		"topic":       topic,
+		"subscribers": delivered,
+	}); err != nil {
+		log.Printf("Error writing publish response: %v", err)
+	}
+}
+
+// publishDemoEvents 每隔一段时间向默认主题发布一条示例事件，直到 stop 被关闭
+func publishDemoEvents(stop <-chan struct{}) {
+	ticker := newStreamTicker(800 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 1; ; i++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+		}
+
+		event := map[string]interface{}{
+			"id":        i,
+			"timestamp": time.Now().Unix(),
+			"data":      fmt.Sprintf("SSE Event #%d", i),
+			"random":    time.Now().Nanosecond() % 1000,
+		}
+		jsonData, _ := json.Marshal(event)
+		sseBroker.publish(defaultTopic, "", string(jsonData))
+	}
+}
+
+// parseTopics 把逗号分隔的主题列表拆开，去掉空白和重复项
+func parseTopics(param string) []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, topic := range strings.Split(param, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// sseLineEndings 把 CRLF 和单独的 CR 统一为 LF
+var sseLineEndings = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// writeSSEEvent 按 SSE 格式写出一条事件并刷新缓冲区，id 和 event 为空时省略对应字段
+func writeSSEEvent(w http.ResponseWriter, id, event, data string) error {
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	// SSE 格式：data: {json}\n\n，多行数据需要拆成多个 data 字段。
+	// SSE 把 CRLF、LF 和单独的 CR 都当作行尾，所以三者都要拆分，否则数据中的 CR 可以注入其他字段
+	for _, line := range strings.Split(sseLineEndings.Replace(data), "\n") {
+		if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprint(w, "\n"); err != nil {
+		return err
+	}
+
 	if flusher, ok := w.(http.Flusher); ok {
 		flusher.Flush()
 	}
+	return nil
 }
 
 // 主页处理器
@@ -193,11 +429,23 @@ func indexHandler(w http.ResponseWriter, _ *http.Request) {
 
         <div class="endpoint">
             <h3>3. Server-Sent Events (/sse)</h3>
-            <p>使用 SSE 协议的事件流</p>
+            <p>使用 SSE 协议的事件流，订阅默认主题 demo，收到 15 个事件后结束</p>
             <button onclick="startSSE()">开始 SSE 流</button>
             <button onclick="stopSSE()">停止 SSE 流</button>
             <div id="sse-output" class="output"></div>
         </div>
+
+        <div class="endpoint">
+            <h3>4. WebSocket (/ws)</h3>
+            <p>通过 WebSocket 推送同样的 JSON 数据，可以暂停、恢复和调整发送间隔</p>
+            <button onclick="startWS()">连接 WebSocket</button>
+            <button onclick="sendWSCommand({type: 'pause'})">暂停</button>
+            <button onclick="sendWSCommand({type: 'resume'})">恢复</button>
+            <input id="ws-interval" value="200ms" size="8">
+            <button onclick="sendWSCommand({type: 'set-interval', interval: document.getElementById('ws-interval').value})">设置间隔</button>
+            <button onclick="stopWS()">断开</button>
+            <div id="ws-output" class="output"></div>
+        </div>
     </div>
 
     <script>
@@ -265,7 +513,7 @@ func indexHandler(w http.ResponseWriter, _ *http.Request) {
                 eventSource.close();
             }
             
-            eventSource = new EventSource('/sse');
+            eventSource = new EventSource('/sse?limit=15');
             
             eventSource.onopen = function(event) {
                 output.textContent += 'SSE connection opened\n';
@@ -293,6 +541,47 @@ func indexHandler(w http.ResponseWriter, _ *http.Request) {
             };
         }
 
+        let socket = null;
+
+        function startWS() {
+            const output = document.getElementById('ws-output');
+            output.textContent = 'Connecting to WebSocket...\n';
+
+            if (socket) {
+                socket.close();
+            }
+
+            const scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+            socket = new WebSocket(scheme + location.host + '/ws');
+
+            socket.onopen = function() {
+                output.textContent += 'WebSocket connection opened\n';
+            };
+
+            socket.onmessage = function(event) {
+                output.textContent += event.data + '\n';
+                output.scrollTop = output.scrollHeight;
+            };
+
+            socket.onclose = function(event) {
+                output.textContent += 'WebSocket closed (' + event.code + ' ' + event.reason + ')\n';
+                output.scrollTop = output.scrollHeight;
+                socket = null;
+            };
+        }
+
+        function sendWSCommand(command) {
+            if (socket && socket.readyState === WebSocket.OPEN) {
+                socket.send(JSON.stringify(command));
+            }
+        }
+
+        function stopWS() {
+            if (socket) {
+                socket.close();
+            }
+        }
+
         function stopSSE() {
             if (eventSource) {
                 eventSource.close();
@@ -312,21 +601,145 @@ func indexHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 func main() {
+	replayWindow := flag.Duration("sse-replay-window", 5*time.Minute, "SSE 事件日志的保留时间，超过后无法通过 Last-Event-ID 恢复")
+	flag.DurationVar(&sseRetry, "sse-retry", sseRetry, "发送给 SSE 客户端的重连间隔提示")
+	slowSubscriber := flag.String("slow-subscriber", string(policyDrop), "订阅者队列已满时的处理策略：drop 或 disconnect")
+	drainTimeout := flag.Duration("drain-timeout", 10*time.Second, "关闭时等待正在进行的流结束的最长时间")
+	sseCompression := flag.Bool("sse-compression", true, "是否对 /sse 响应启用 gzip/deflate 压缩，设为 false 时不压缩")
+	h2c := flag.Bool("h2c", false, "在明文连接上启用 HTTP/2 (h2c)")
+	tlsCert := flag.String("tls-cert", "", "TLS 证书文件，与 -tls-key 一起提供时启用 HTTPS 和 HTTP/2")
+	tlsKey := flag.String("tls-key", "", "TLS 私钥文件")
+	replayFile := flag.String("replay", "", "录制文件路径，提供时在 /replay 按录制节奏重放")
+	replaySpeed := flag.Float64("replay-speed", 1, "/replay 的默认重放倍速")
+	flag.IntVar(&limiter.maxCount, "max-count", limiter.maxCount, "count 参数允许的最大值，0 表示不限制")
+	flag.IntVar(&limiter.maxPerClient, "max-streams-per-client", limiter.maxPerClient, "每个客户端 IP 允许的最大并发流数量，0 表示不限制")
+	flag.IntVar(&limiter.maxTotal, "max-streams", limiter.maxTotal, "服务器允许的最大并发流数量，0 表示不限制")
+	muxRemote := flag.String("mux-remote-hosts", "", "/sse/mux 允许访问的远程主机，逗号分隔，条目为 host 或 host:port；为空时不允许远程上游")
+	flag.DurationVar(&muxRemoteClient.Timeout, "mux-remote-timeout", muxRemoteClient.Timeout, "/sse/mux 单个远程上游的最长持续时间")
+	flag.Parse()
+
+	muxRemoteHosts = parseHostList(*muxRemote)
+
+	policy, err := parseSlowPolicy(*slowSubscriber)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 创建事件中心，启动事件日志的过期清理和示例事件发布
+	sseBroker = newBroker(newEventLogStore(*replayWindow), policy)
+	stop := make(chan struct{})
+	defer close(stop)
+	go sseBroker.logs.expireLoop(stop)
+	go publishDemoEvents(stop)
+
 	// 注册路由
 	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/stream/json", streamJSONHandler)
-	http.HandleFunc("/stream/text", streamTextHandler)
-	http.HandleFunc("/sse", sseHandler)
+	http.HandleFunc("/stream/json", limitStreams("/stream/json", instrument("/stream/json", compress(streamJSONHandler))))
+	http.HandleFunc("/stream/text", limitStreams("/stream/text", instrument("/stream/text", compress(streamTextHandler))))
+	http.HandleFunc("/ws", limitStreams("/ws", instrument("/ws", wsHandler)))
+	http.HandleFunc("/publish/", publishHandler)
+	http.HandleFunc("/ingest", limitStreams("/ingest", instrument("/ingest", compress(ingestHandler))))
+	if *sseCompression {
+		http.HandleFunc("/sse", limitStreams("/sse", instrument("/sse", compress(sseHandler))))
+		http.HandleFunc("/sse/mux", limitStreams("/sse/mux", instrument("/sse/mux", compress(muxHandler))))
+	} else {
+		http.HandleFunc("/sse", limitStreams("/sse", instrument("/sse", sseHandler)))
+		http.HandleFunc("/sse/mux", limitStreams("/sse/mux", instrument("/sse/mux", muxHandler)))
+	}
+	http.HandleFunc("/metrics", metricsHandler)
+
+	// 重放模式：按原始节奏或指定倍速重放 cmd/client record 录制的流
+	if *replayFile != "" {
+		if *replaySpeed <= 0 {
+			log.Fatal("-replay-speed must be positive")
+		}
+		rec, err := loadRecording(*replayFile)
+		if err != nil {
+			log.Fatalf("Failed to load recording %s: %v", *replayFile, err)
+		}
+		handler := replayHandler(rec, *replaySpeed)
+		if rec.Header.Kind != recording.KindSSE || *sseCompression {
+			handler = compress(handler)
+		}
+		http.HandleFunc("/replay", limitStreams("/replay", instrument("/replay", handler)))
+		log.Printf("Loaded recording %s: %d %s messages from %s", *replayFile, len(rec.Entries), rec.Header.Kind, rec.Header.URL)
+	}
 
-	port := ":8080"
-	log.Printf("Starting streamable HTTP server on http://localhost%s", port)
+	server := &http.Server{
+		Addr:              ":8080",
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	// Shutdown 开始时通知所有流发送结束标记
+	server.RegisterOnShutdown(startDraining)
+
+	// 提供证书时使用 TLS，net/http 会自动通过 ALPN 协商 HTTP/2；
+	// 否则可以通过 -h2c 在明文连接上启用 HTTP/2，让大量流复用同一个连接
+	useTLS := *tlsCert != "" || *tlsKey != ""
+	if useTLS && (*tlsCert == "" || *tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	if useTLS {
+		server.Protocols.SetHTTP2(true)
+	} else if *h2c {
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	port := server.Addr
+	log.Printf("Starting streamable HTTP server on %s://localhost%s (protocols: %s)", scheme, port, server.Protocols)
 	log.Printf("Available endpoints:")
 	log.Printf("  - http://localhost%s/           (Demo page)", port)
 	log.Printf("  - http://localhost%s/stream/json (JSON stream)", port)
 	log.Printf("  - http://localhost%s/stream/text (Text stream)", port)
 	log.Printf("  - http://localhost%s/sse         (Server-Sent Events)", port)
+	log.Printf("  - http://localhost%s/sse/mux?source=json&source=text (Multiplexed SSE)", port)
+	log.Printf("  - ws://localhost%s/ws            (WebSocket JSON stream)", port)
+	log.Printf("  - http://localhost%s/publish/{topic} (Publish to SSE topic, POST)", port)
+	log.Printf("  - http://localhost%s/ingest      (NDJSON upload with streamed acks, POST)", port)
+	log.Printf("  - http://localhost%s/metrics     (Prometheus metrics)", port)
+	if *replayFile != "" {
+		log.Printf("  - http://localhost%s/replay      (Replay of %s)", port, *replayFile)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			serverErr <- server.ListenAndServeTLS(*tlsCert, *tlsKey)
+			return
+		}
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// 等待 SIGINT/SIGTERM
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
 
-	if err := http.ListenAndServe(port, nil); err != nil {
+	select {
+	case err := <-serverErr:
 		log.Fatal("Server failed to start:", err)
+	case <-ctx.Done():
+	}
+
+	// 停止接受新连接，等待正在进行的流发送结束标记后退出，超过 drainTimeout 则强制关闭
+	log.Printf("Shutting down, draining open streams for up to %s", *drainTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Drain timeout exceeded, closing remaining connections: %v", err)
+		if err := server.Close(); err != nil {
+			log.Printf("Error closing server: %v", err)
+		}
+	}
+	// WebSocket 连接已被劫持，Shutdown 不会等待它们。它们收到 draining 后自行发送关闭帧，
+	// 超时仍未结束的连接以 1001 强制关闭
+	if n := hijacked.wait(shutdownCtx); n > 0 {
+		log.Printf("Closed %d WebSocket connections that did not finish draining", n)
 	}
+	log.Printf("Server stopped")
 }
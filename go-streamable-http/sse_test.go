@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openSSE 订阅 query 指定的主题，读取并检查连接时的 retry 提示和欢迎消息
+func openSSE(t *testing.T, srv string, query string, header http.Header) *bufio.Reader {
+	t.Helper()
+	resp := get(t, srv+query, header)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	want := []string{fmt.Sprintf("retry: %d", sseRetry.Milliseconds()), "data: Connected to SSE stream"}
+	if block := readSSEBlock(t, br); strings.Join(block, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("first block = %q, want %q", block, want)
+	}
+	return br
+}
+
+func TestSSE(t *testing.T) {
+	srv := newTestServer(t, sseHandler)
+
+	tests := []struct {
+		name    string
+		topics  string
+		limit   int
+		publish []struct{ topic, event, data string }
+		want    [][]string // 不含 id 行
+	}{
+		{
+			name:   "single event",
+			topics: "sse-single",
+			limit:  1,
+			publish: []struct{ topic, event, data string }{
+				{"sse-single", "", `{"n":1}`},
+			},
+			want: [][]string{{`data: {"n":1}`}},
+		},
+		{
+			name:   "event type and multi-line data",
+			topics: "sse-multiline",
+			limit:  1,
+			publish: []struct{ topic, event, data string }{
+				{"sse-multiline", "update", "first\nsecond"},
+			},
+			want: [][]string{{"event: update", "data: first", "data: second"}},
+		},
+		{
+			name:   "CR in data cannot start another field",
+			topics: "sse-cr",
+			limit:  1,
+			publish: []struct{ topic, event, data string }{
+				{"sse-cr", "", "a\rid: 7\r\nevent: x"},
+			},
+			want: [][]string{{"data: a", "data: id: 7", "data: event: x"}},
+		},
+		{
+			name:   "only subscribed topics",
+			topics: "sse-a,sse-b",
+			limit:  2,
+			publish: []struct{ topic, event, data string }{
+				{"sse-a", "", "a"},
+				{"sse-other", "", "other"},
+				{"sse-b", "", "b"},
+			},
+			want: [][]string{{"data: a"}, {"data: b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := openSSE(t, srv.URL, fmt.Sprintf("?topic=%s&limit=%d", tt.topics, tt.limit), nil)
+
+			// 读到欢迎消息时订阅已经建立，之后发布的事件都会送达
+			for _, p := range tt.publish {
+				sseBroker.publish(p.topic, p.event, p.data)
+			}
+
+			var lastID uint64
+			for i, want := range tt.want {
+				block := readSSEBlock(t, br)
+				var id uint64
+				if len(block) == 0 || !strings.HasPrefix(block[0], "id: ") {
+					t.Fatalf("event %d = %q, want id line first", i, block)
+				}
+				if _, err := fmt.Sscan(strings.TrimPrefix(block[0], "id: "), &id); err != nil || id <= lastID {
+					t.Fatalf("event %d has id %q after %d", i, block[0], lastID)
+				}
+				lastID = id
+				if got := strings.Join(block[1:], "\n"); got != strings.Join(want, "\n") {
+					t.Errorf("event %d = %q, want %q", i, block[1:], want)
+				}
+			}
+
+			if block := readSSEBlock(t, br); strings.Join(block, "\n") != "event: close\ndata: Stream ended" {
+				t.Errorf("final block = %q, want close event", block)
+			}
+			expectEOF(t, br)
+		})
+	}
+}
+
+func TestSSELastEventID(t *testing.T) {
+	srv := newTestServer(t, sseHandler)
+
+	const topic = "sse-resume"
+	var ids []uint64
+	for i := 1; i <= 3; i++ {
+		id, _ := sseBroker.publish(topic, "", fmt.Sprintf("missed %d", i))
+		ids = append(ids, id)
+	}
+
+	// 从第一个事件之后恢复，先重放错过的两个事件，再接收实时事件
+	br := openSSE(t, srv.URL, "?topic="+topic+"&limit=3", http.Header{"Last-Event-ID": {fmt.Sprint(ids[0])}})
+	for i, id := range ids[1:] {
+		want := fmt.Sprintf("id: %d\ndata: missed %d", id, i+2)
+		if block := readSSEBlock(t, br); strings.Join(block, "\n") != want {
+			t.Fatalf("replayed %q, want %q", block, want)
+		}
+	}
+
+	live, _ := sseBroker.publish(topic, "", "live")
+	if block := readSSEBlock(t, br); strings.Join(block, "\n") != fmt.Sprintf("id: %d\ndata: live", live) {
+		t.Fatalf("live event = %q", block)
+	}
+	readSSEBlock(t, br)
+	expectEOF(t, br)
+}
+
+func TestSSELastEventIDGap(t *testing.T) {
+	const ttl = time.Minute
+	orig := sseBroker
+	sseBroker = newBroker(newEventLogStore(ttl), policyDrop)
+	t.Cleanup(func() { sseBroker = orig })
+
+	srv := newTestServer(t, sseHandler)
+
+	tests := []struct {
+		name  string
+		topic string
+		// setup 发布事件并返回客户端恢复时携带的 Last-Event-ID
+		setup func() uint64
+	}{
+		{"trimmed", "gap-trimmed", func() uint64 {
+			// 客户端收到第一个事件后断开，第二个事件随后被截断
+			first, _ := sseBroker.publish("gap-trimmed", "", "received")
+			sseBroker.publish("gap-trimmed", "", "dropped")
+			for i := 0; i < maxLoggedEvents; i++ {
+				sseBroker.publish("gap-trimmed", "", "kept")
+			}
+			return first
+		}},
+		{"expired", "gap-expired", func() uint64 {
+			first, _ := sseBroker.publish("gap-expired", "", "expired")
+			sseBroker.publish("gap-expired", "", "expired")
+			sseBroker.logs.expire(time.Now().Add(2 * ttl))
+			return first
+		}},
+		{"unknown", "gap-unknown", func() uint64 {
+			seq, _ := sseBroker.publish("gap-unknown", "", "current")
+			return seq + 100
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastSeq := tt.setup()
+
+			br := openSSE(t, srv.URL, "?topic="+tt.topic+"&limit=1", http.Header{"Last-Event-ID": {fmt.Sprint(lastSeq)}})
+			want := fmt.Sprintf("event: reset\ndata: Events after %d are no longer available", lastSeq)
+			if block := readSSEBlock(t, br); strings.Join(block, "\n") != want {
+				t.Fatalf("first event = %q, want %q", block, want)
+			}
+
+			// reset 之后照常重放仍在日志中的事件，没有可重放的事件时继续接收实时事件
+			want = "data: kept"
+			if tt.name != "trimmed" {
+				sseBroker.publish(tt.topic, "", "live")
+				want = "data: live"
+			}
+			if block := readSSEBlock(t, br); len(block) != 2 || block[1] != want {
+				t.Fatalf("event after reset = %q, want %q", block, want)
+			}
+		})
+	}
+
+	// 日志完整时不发送 reset
+	seq, _ := sseBroker.publish("gap-none", "", "first")
+	next, _ := sseBroker.publish("gap-none", "", "second")
+	br := openSSE(t, srv.URL, "?topic=gap-none&limit=1", http.Header{"Last-Event-ID": {fmt.Sprint(seq)}})
+	if block := readSSEBlock(t, br); strings.Join(block, "\n") != fmt.Sprintf("id: %d\ndata: second", next) {
+		t.Fatalf("replayed %q, want the second event without reset", block)
+	}
+}
+
+func TestEventLogExpiry(t *testing.T) {
+	const ttl = time.Minute
+	logs := newEventLogStore(ttl)
+	now := time.Now()
+
+	// 持续有新事件的主题里，旧事件也会按发布时间过期
+	busy := logs.getOrCreate("busy")
+	busy.append(sseEvent{Seq: 1, Data: "old", At: now.Add(-2 * ttl)})
+	busy.append(sseEvent{Seq: 2, Data: "new", At: now})
+	events, complete := logs.since("busy", 0)
+	if len(events) != 1 || events[0].Seq != 2 || complete {
+		t.Fatalf("since(0) = %+v, complete %v; want only event 2 and a gap", events, complete)
+	}
+	if _, complete := logs.since("busy", 1); !complete {
+		t.Error("since(1) reports a gap although only event 1 expired")
+	}
+
+	// 反复重连读取日志不会延长事件的保留时间
+	quiet := logs.getOrCreate("quiet")
+	quiet.append(sseEvent{Seq: 3, Data: "quiet", At: now})
+	for i := 0; i < 3; i++ {
+		logs.since("quiet", 0)
+	}
+	if removed := logs.expire(now.Add(2 * ttl)); removed != 2 {
+		t.Errorf("expire removed %d logs, want 2", removed)
+	}
+	if events, complete := logs.since("quiet", 0); len(events) != 0 || complete {
+		t.Errorf("since(0) after expiry = %+v, complete %v; want a gap", events, complete)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/publish/", publishHandler)
+	mux.HandleFunc("/sse", sseHandler)
+	srv := newTestServer(t, mux.ServeHTTP)
+
+	br := openSSE(t, srv.URL+"/sse", "?topic=publish-test&limit=1", nil)
+
+	resp, err := testClient.Post(srv.URL+"/publish/publish-test?event=news", "text/plain", strings.NewReader("hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", resp.StatusCode)
+	}
+	var result struct {
+		ID          uint64 `json:"id"`
+		Topic       string `json:"topic"`
+		Subscribers int    `json:"subscribers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Topic != "publish-test" || result.Subscribers != 1 || result.ID == 0 {
+		t.Errorf("publish result = %+v", result)
+	}
+
+	want := fmt.Sprintf("id: %d\nevent: news\ndata: hello", result.ID)
+	if block := readSSEBlock(t, br); strings.Join(block, "\n") != want {
+		t.Errorf("event = %q, want %q", block, want)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "GET", method: http.MethodGet, path: "/publish/publish-test", want: http.StatusMethodNotAllowed},
+		{name: "empty topic", method: http.MethodPost, path: "/publish/", want: http.StatusBadRequest},
+		{name: "nested topic", method: http.MethodPost, path: "/publish/a/b", want: http.StatusBadRequest},
+		{name: "multi-line event", method: http.MethodPost, path: "/publish/x?event=a%0Ab", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader("data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := testClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
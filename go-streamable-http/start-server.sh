@@ -9,5 +9,5 @@ if [ -f "./server" ]; then
     ./server
 else
     echo "编译并启动服务器..."
-    go run server.go types.go
+    go run .
 fi
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go-streamable-http/recording"
+)
+
+func TestStreamJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		query     string
+		encoding  string
+		wantCount int
+	}{
+		{name: "default count", handler: streamJSONHandler, wantCount: 10},
+		{name: "custom count", handler: streamJSONHandler, query: "?count=3", wantCount: 3},
+		{name: "zero count uses default", handler: streamJSONHandler, query: "?count=0", wantCount: 10},
+		{name: "invalid count uses default", handler: streamJSONHandler, query: "?count=abc", wantCount: 10},
+		{name: "gzip", handler: compress(streamJSONHandler), query: "?count=4", encoding: "gzip", wantCount: 4},
+		{name: "deflate", handler: compress(streamJSONHandler), query: "?count=4", encoding: "deflate", wantCount: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useManualTicker(t)
+			srv := newTestServer(t, tt.handler)
+
+			header := http.Header{"Accept-Encoding": {"identity"}}
+			if tt.encoding != "" {
+				header.Set("Accept-Encoding", tt.encoding)
+			}
+			resp := get(t, srv.URL+tt.query, header)
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			br := bodyReader(t, resp, tt.encoding)
+			ticker := clock.next(t)
+
+			for i := 1; i <= tt.wantCount; i++ {
+				// 每条消息必须在处理器等待下一个 tick 之前就能读到
+				line := readLine(t, br)
+
+				var data StreamData
+				dec := json.NewDecoder(strings.NewReader(line))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(&data); err != nil {
+					t.Fatalf("line %d is not a StreamData object: %v (%q)", i, err, line)
+				}
+				if dec.More() {
+					t.Fatalf("line %d holds more than one JSON value: %q", i, line)
+				}
+				if data.Count != i || data.Message != fmt.Sprintf("Stream message #%d", i) || data.Final {
+					t.Fatalf("line %d = %+v", i, data)
+				}
+
+				if i < tt.wantCount {
+					ticker.tick(t)
+				}
+			}
+			expectEOF(t, br)
+		})
+	}
+}
+
+func TestStreamText(t *testing.T) {
+	linePattern := regexp.MustCompile(`^\[\d{2}:\d{2}:\d{2}\] Streaming line (\d+) - Current time: \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`)
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		encoding string
+	}{
+		{name: "plain", handler: streamTextHandler},
+		{name: "gzip", handler: compress(streamTextHandler), encoding: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useManualTicker(t)
+			srv := newTestServer(t, tt.handler)
+
+			header := http.Header{"Accept-Encoding": {"identity"}}
+			if tt.encoding != "" {
+				header.Set("Accept-Encoding", tt.encoding)
+			}
+			resp := get(t, srv.URL, header)
+			if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			br := bodyReader(t, resp, tt.encoding)
+			ticker := clock.next(t)
+
+			const total = 20
+			for i := 1; i <= total; i++ {
+				line := readLine(t, br)
+				m := linePattern.FindStringSubmatch(line)
+				if m == nil || m[1] != fmt.Sprint(i) {
+					t.Fatalf("line %d = %q", i, line)
+				}
+				if i < total {
+					ticker.tick(t)
+				}
+			}
+			expectEOF(t, br)
+		})
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		query   string
+	}{
+		{name: "json", handler: streamJSONHandler, query: "?count=5&timeout=20ms"},
+		{name: "text", handler: streamTextHandler, query: "?timeout=20ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 不触发 tick，流只能发送第一条消息，然后在截止时间结束
+			useManualTicker(t)
+			srv := newTestServer(t, tt.handler)
+
+			br := bufio.NewReader(get(t, srv.URL+tt.query, nil).Body)
+			readLine(t, br)
+			expectEOF(t, br)
+		})
+	}
+}
+
+// allowMuxRemoteHosts 在测试期间设置 /sse/mux 允许访问的远程主机
+func allowMuxRemoteHosts(t *testing.T, hosts string) {
+	orig := muxRemoteHosts
+	muxRemoteHosts = parseHostList(hosts)
+	t.Cleanup(func() { muxRemoteHosts = orig })
+}
+
+func TestMux(t *testing.T) {
+	allowMuxRemoteHosts(t, "127.0.0.1")
+	remote := newTestServer(t, streamJSONHandler)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	srv := newTestServer(t, muxHandler)
+	query := url.Values{"source": {
+		"json?count=2&interval=10ms",
+		"lines=text?interval=10ms&timeout=1s",
+		"prices=" + remote.URL + "?count=3&interval=10ms",
+		"down=http://" + closed.Addr().String() + "/",
+	}}
+	br := bufio.NewReader(get(t, srv.URL+"?"+query.Encode(), nil).Body)
+
+	if block := readSSEBlock(t, br); len(block) != 1 || !strings.HasPrefix(block[0], "retry: ") {
+		t.Fatalf("first block = %q, want retry hint", block)
+	}
+
+	counts := make(map[string]int)
+	done := make(map[string]int)
+	var errorSources []string
+	for {
+		block := readSSEBlock(t, br)
+		if len(block) != 2 || !strings.HasPrefix(block[0], "event: ") || !strings.HasPrefix(block[1], "data: ") {
+			t.Fatalf("malformed event %q", block)
+		}
+		event := strings.TrimPrefix(block[0], "event: ")
+		data := strings.TrimPrefix(block[1], "data: ")
+
+		var status struct {
+			Source string `json:"source"`
+			Count  int    `json:"count"`
+			Error  string `json:"error"`
+		}
+		switch event {
+		case "close":
+			if data != "All sources finished" {
+				t.Errorf("close data = %q", data)
+			}
+			expectEOF(t, br)
+
+			want := map[string]int{"json": 2, "lines": 20, "prices": 3}
+			for name, n := range want {
+				if counts[name] != n || done[name] != n {
+					t.Errorf("source %s: got %d events and done count %d, want %d", name, counts[name], done[name], n)
+				}
+			}
+			if len(errorSources) != 1 || errorSources[0] != "down" {
+				t.Errorf("error events from %v, want [down]", errorSources)
+			}
+			return
+		case "done", "error":
+			if err := json.Unmarshal([]byte(data), &status); err != nil {
+				t.Fatalf("%s event data: %v", event, err)
+			}
+			if event == "done" {
+				done[status.Source] = status.Count
+			} else {
+				errorSources = append(errorSources, status.Source)
+			}
+		default:
+			counts[event]++
+		}
+	}
+}
+
+func TestMuxBadRequest(t *testing.T) {
+	srv := newTestServer(t, muxHandler)
+
+	tests := []struct {
+		name    string
+		sources []string
+	}{
+		{name: "no source"},
+		{name: "unknown source", sources: []string{"ftp://example.com"}},
+		{name: "duplicate name", sources: []string{"json", "json"}},
+		{name: "reserved name", sources: []string{"close=json"}},
+		{name: "remote sources disabled", sources: []string{"http://127.0.0.1/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := testClient.Get(srv.URL + "?" + url.Values{"source": tt.sources}.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestMuxLineEndings(t *testing.T) {
+	allowMuxRemoteHosts(t, "127.0.0.1")
+
+	// 上游用单独的 CR 分隔“行”，试图在合并后的流里注入 id 和 event 字段
+	remote := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "a\rid: 99\revent: close\r\ndata: b\n")
+	})
+	srv := newTestServer(t, muxHandler)
+
+	br := bufio.NewReader(get(t, srv.URL+"?"+url.Values{"source": {"up=" + remote.URL}}.Encode(), nil).Body)
+	readSSEBlock(t, br)
+	for _, want := range []string{"a", "id: 99", "event: close", "data: b"} {
+		block := readSSEBlock(t, br)
+		if strings.Join(block, "\n") != "event: up\ndata: "+want {
+			t.Fatalf("event = %q, want upstream line %q", block, want)
+		}
+	}
+	if block := readSSEBlock(t, br); len(block) != 2 || block[0] != "event: done" {
+		t.Fatalf("event = %q, want done", block)
+	}
+}
+
+func TestMuxRemoteHosts(t *testing.T) {
+	allowMuxRemoteHosts(t, "127.0.0.1")
+
+	// 允许列表中的主机重定向到列表之外的主机，重定向不会被跟随
+	target := newTestServer(t, streamJSONHandler)
+	redirect := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	})
+	srv := newTestServer(t, muxHandler)
+
+	resp, err := testClient.Get(srv.URL + "?" + url.Values{"source": {"http://localhost:1/"}}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "not allowed") {
+		t.Errorf("disallowed host: status %d %q, want 400", resp.StatusCode, body)
+	}
+
+	br := bufio.NewReader(get(t, srv.URL+"?"+url.Values{"source": {"r=" + redirect.URL}}.Encode(), nil).Body)
+	readSSEBlock(t, br)
+	block := readSSEBlock(t, br)
+	if len(block) != 2 || block[0] != "event: error" || !strings.Contains(block[1], "redirect to host") {
+		t.Fatalf("event = %q, want error for the redirect", block)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	srv := newTestServer(t, ingestHandler)
+
+	body := strings.Join([]string{
+		`{"timestamp":1,"message":"a","count":1}`,
+		``,
+		`not json`,
+		`{"timestamp":2,"message":"b"}`,
+		`{"timestamp":3,"message":"c","count":3,"extra":true}`,
+		`[1,2]`,
+		`{"timestamp":4,"message":"d","count":4,"final":true}`,
+	}, "\n")
+	resp, err := testClient.Post(srv.URL, "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	wantAcks := []ingestAck{
+		{Line: 1, OK: true},
+		{Line: 3, Error: "invalid JSON"},
+		{Line: 4, Error: "missing required fields: count"},
+		{Line: 5, Error: `unknown field "extra"`},
+		{Line: 6, Error: "line must be a JSON object"},
+		{Line: 7, OK: true},
+	}
+	br := bufio.NewReader(resp.Body)
+	for _, want := range wantAcks {
+		var ack ingestAck
+		if err := json.Unmarshal([]byte(readLine(t, br)), &ack); err != nil {
+			t.Fatal(err)
+		}
+		if ack.Line != want.Line || ack.OK != want.OK || !strings.Contains(ack.Error, want.Error) {
+			t.Errorf("ack = %+v, want %+v", ack, want)
+		}
+	}
+
+	var summary ingestSummary
+	if err := json.Unmarshal([]byte(readLine(t, br)), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if want := (ingestSummary{Done: true, Accepted: 2, Rejected: 4}); summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+	expectEOF(t, br)
+}
+
+func TestLimits(t *testing.T) {
+	orig := limiter
+	limiter = newStreamLimiter(5, 1, 0)
+	t.Cleanup(func() { limiter = orig })
+
+	clock := useManualTicker(t)
+	endpoint := testEndpoint(t)
+	srv := newTestServer(t, limitStreams(endpoint, streamJSONHandler))
+
+	expectRejected := func(t *testing.T, query string) {
+		t.Helper()
+		resp, err := testClient.Get(srv.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("status = %d, want 429", resp.StatusCode)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Error("missing Retry-After")
+		}
+	}
+
+	expectRejected(t, "?count=6")
+
+	// 第一个流保持打开，同一客户端的第二个流超过限制
+	br := bufio.NewReader(get(t, srv.URL+"?count=2", nil).Body)
+	ticker := clock.next(t)
+	readLine(t, br)
+	expectRejected(t, "?count=1")
+
+	// 第一个流结束后名额被释放
+	ticker.tick(t)
+	readLine(t, br)
+	expectEOF(t, br)
+	resp := get(t, srv.URL+"?count=1", nil)
+	io.Copy(io.Discard, resp.Body)
+
+	out := metricsOutput(t)
+	for _, want := range []string{
+		fmt.Sprintf(`stream_rejected_total{endpoint=%q,reason="count"} 1`, endpoint),
+		fmt.Sprintf(`stream_rejected_total{endpoint=%q,reason="per_client"} 1`, endpoint),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestMuxLimits(t *testing.T) {
+	orig := limiter
+	limiter = newStreamLimiter(0, 0, 3)
+	t.Cleanup(func() { limiter = orig })
+
+	endpoint := testEndpoint(t)
+	srv := newTestServer(t, limitStreams(endpoint, muxHandler))
+
+	// 请求本身占用一个名额，每个上游再各占一个：三个上游需要四个名额
+	resp, err := testClient.Get(srv.URL + "?" + url.Values{"source": {"a=json?count=1", "b=json?count=1", "c=json?count=1"}}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("three sources: status = %d, want 429", resp.StatusCode)
+	}
+
+	resp = get(t, srv.URL+"?"+url.Values{"source": {"a=json?count=1", "b=json?count=1"}}.Encode(), nil)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// 上游结束后名额全部释放
+	limiter.mu.Lock()
+	total := limiter.total
+	limiter.mu.Unlock()
+	if total != 0 {
+		t.Errorf("streams still held after the response = %d, want 0", total)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	endpoint := testEndpoint(t)
+	srv := newTestServer(t, instrument(endpoint, streamJSONHandler))
+
+	resp := get(t, srv.URL+"?count=2&interval=10ms", nil)
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := metricsOutput(t)
+	for _, want := range []string{
+		fmt.Sprintf("stream_open_streams{endpoint=%q} 0", endpoint),
+		fmt.Sprintf("stream_streams_total{endpoint=%q} 1", endpoint),
+		fmt.Sprintf("stream_flushed_bytes_total{endpoint=%q} %d", endpoint, n),
+		fmt.Sprintf(`stream_flush_duration_seconds_bucket{endpoint=%q,le="+Inf"} 2`, endpoint),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %s\n%s", want, out)
+		}
+	}
+}
+
+// metricsOutput 返回 /metrics 的当前输出
+func metricsOutput(t *testing.T) string {
+	t.Helper()
+	srv := newTestServer(t, metricsHandler)
+	body, err := io.ReadAll(get(t, srv.URL, nil).Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestReplay(t *testing.T) {
+	rec := &recording.Recording{
+		Header: recording.Header{Kind: recording.KindNDJSON, ContentType: "application/json"},
+		Entries: []recording.Entry{
+			{OffsetUS: 0, Data: "{\"count\":1}\n"},
+			{OffsetUS: 500000, Data: "{\"count\":2}\n"},
+			{OffsetUS: 1000000, Data: "{\"count\":3}\n"},
+		},
+	}
+	srv := newTestServer(t, replayHandler(rec, 1))
+
+	// 100 倍速下 1 秒的录制应该在 10ms 左右重放完
+	started := time.Now()
+	resp := get(t, srv.URL+"?speed=100", nil)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 10*time.Millisecond || elapsed > time.Second {
+		t.Errorf("replay took %s", elapsed)
+	}
+	if want := "{\"count\":1}\n{\"count\":2}\n{\"count\":3}\n"; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	bad, err := testClient.Get(srv.URL + "?speed=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("speed=0: status = %d, want 400", bad.StatusCode)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	srv := newTestServer(t, indexHandler)
+
+	resp := get(t, srv.URL, nil)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, endpoint := range []string{"/stream/json", "/stream/text", "/sse"} {
+		if !bytes.Contains(body, []byte(endpoint)) {
+			t.Errorf("index page does not reference %s", endpoint)
+		}
+	}
+}
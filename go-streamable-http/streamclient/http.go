@@ -0,0 +1,84 @@
+// Package streamclient 提供消费 go-streamable-http 服务器流式响应的客户端工具：
+// 按行解码 NDJSON 的类型化迭代器，以及符合规范的 Server-Sent Events 读取器。
+// 两者都支持通过 context 取消。
+package streamclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// StreamData 与服务器端 /stream/json 返回的数据结构保持一致
+type StreamData struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+	Count     int    `json:"count"`
+	// Final 为 true 表示服务器即将关闭，这是流中的最后一条消息
+	Final bool `json:"final,omitempty"`
+}
+
+// StatusError 表示服务器返回了非 200 的状态码
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+// OpenJSONStream 请求一个 NDJSON 流并返回 StreamData 的迭代器，client 为 nil 时使用 http.DefaultClient
+func OpenJSONStream(ctx context.Context, client *http.Client, url string) (*NDJSONDecoder[StreamData], error) {
+	body, err := openStream(ctx, client, url, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewNDJSONDecoder[StreamData](ctx, body), nil
+}
+
+// OpenSSEStream 请求一个 SSE 流并返回事件读取器，client 为 nil 时使用 http.DefaultClient
+func OpenSSEStream(ctx context.Context, client *http.Client, url string) (*SSEReader, error) {
+	body, err := openStream(ctx, client, url, "text/event-stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewSSEReader(ctx, body), nil
+}
+
+// openStream 发起 GET 请求并在状态码为 200 时返回响应体
+func openStream(ctx context.Context, client *http.Client, url, accept string, header http.Header) (io.ReadCloser, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.Body, nil
+}
+
+// closeOnDone 在 ctx 结束时关闭 r（如果它实现了 io.Closer），让阻塞中的读取立即返回。
+// 返回的函数用于取消这次关注。
+func closeOnDone(ctx context.Context, r io.Reader) func() bool {
+	closer, ok := r.(io.Closer)
+	if !ok {
+		return func() bool { return true }
+	}
+	return context.AfterFunc(ctx, func() { closer.Close() })
+}
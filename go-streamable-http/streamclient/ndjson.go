@@ -0,0 +1,111 @@
+package streamclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// 单行 NDJSON 的最大长度
+const maxLineSize = 1 << 20
+
+// LineError 表示某一行不是合法的 JSON
+type LineError struct {
+	Line int
+	Raw  string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// NDJSONDecoder 逐行解码换行分隔的 JSON 流，用法与 bufio.Scanner 相同：
+//
+//	for dec.Next() {
+//		item := dec.Value()
+//	}
+//	if err := dec.Err(); err != nil { ... }
+//
+// 空行会被跳过，遇到无法解码的行时迭代结束并通过 Err 返回 *LineError。
+type NDJSONDecoder[T any] struct {
+	ctx     context.Context
+	r       io.Reader
+	scanner *bufio.Scanner
+	stop    func() bool
+	line    int
+	value   T
+	err     error
+}
+
+// NewNDJSONDecoder 创建一个从 r 读取 T 类型数据的解码器。
+// ctx 结束时如果 r 实现了 io.Closer 会被关闭，使阻塞的读取立即返回。
+func NewNDJSONDecoder[T any](ctx context.Context, r io.Reader) *NDJSONDecoder[T] {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	return &NDJSONDecoder[T]{
+		ctx:     ctx,
+		r:       r,
+		scanner: scanner,
+		stop:    closeOnDone(ctx, r),
+	}
+}
+
+// Next 读取下一条数据，返回 false 表示流结束或出错
+func (d *NDJSONDecoder[T]) Next() bool {
+	if d.err != nil {
+		return false
+	}
+
+	for d.scanner.Scan() {
+		d.line++
+		line := bytes.TrimSpace(d.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var value T
+		if err := json.Unmarshal(line, &value); err != nil {
+			d.err = &LineError{Line: d.line, Raw: string(line), Err: err}
+			return false
+		}
+		d.value = value
+		return true
+	}
+
+	d.err = d.scanner.Err()
+	if ctxErr := d.ctx.Err(); ctxErr != nil {
+		d.err = ctxErr
+	}
+	if d.err == nil {
+		d.err = io.EOF
+	}
+	return false
+}
+
+// Value 返回最近一次 Next 读取到的数据
+func (d *NDJSONDecoder[T]) Value() T {
+	return d.value
+}
+
+// Err 返回导致迭代结束的错误，流正常结束时返回 nil
+func (d *NDJSONDecoder[T]) Err() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
+
+// Close 关闭底层的 reader（如果它实现了 io.Closer）
+func (d *NDJSONDecoder[T]) Close() error {
+	d.stop()
+	if closer, ok := d.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
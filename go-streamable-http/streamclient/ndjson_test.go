@@ -0,0 +1,93 @@
+package streamclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type item struct {
+	N int `json:"n"`
+}
+
+func TestNDJSONDecoderPartialLines(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		// 一行 JSON 被拆成多次写入，最后一行没有换行符
+		for _, chunk := range []string{`{"n":`, "1}\n\n", `  {"n":2}`, "\r\n{", `"n":3}`} {
+			if _, err := io.WriteString(pw, chunk); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	dec := NewNDJSONDecoder[item](context.Background(), pr)
+	var got []int
+	for dec.Next() {
+		got = append(got, dec.Value().N)
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("values = %v, want [1 2 3]", got)
+	}
+}
+
+func TestNDJSONDecoderInvalidLine(t *testing.T) {
+	dec := NewNDJSONDecoder[item](context.Background(), strings.NewReader("{\"n\":1}\n\n{\"n\":\n{\"n\":3}\n"))
+
+	if !dec.Next() || dec.Value().N != 1 {
+		t.Fatalf("first value = %v, %v", dec.Value(), dec.Err())
+	}
+	if dec.Next() {
+		t.Fatalf("decoded %v from an invalid line", dec.Value())
+	}
+
+	var lineErr *LineError
+	if !errors.As(dec.Err(), &lineErr) {
+		t.Fatalf("Err = %v, want *LineError", dec.Err())
+	}
+	// 空行也计入行号
+	if lineErr.Line != 3 || lineErr.Raw != `{"n":` {
+		t.Errorf("LineError = line %d %q, want line 3 %q", lineErr.Line, lineErr.Raw, `{"n":`)
+	}
+	if dec.Next() {
+		t.Error("Next returned true after an error")
+	}
+}
+
+func TestNDJSONDecoderCancel(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dec := NewNDJSONDecoder[item](ctx, pr)
+	go func() {
+		io.WriteString(pw, `{"n":1}`+"\n")
+		cancel()
+	}()
+
+	if !dec.Next() {
+		t.Fatalf("Next = false, %v", dec.Err())
+	}
+
+	// 取消 ctx 会关闭底层 reader，阻塞中的读取随即返回
+	done := make(chan bool)
+	go func() { done <- dec.Next() }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatalf("Next = true after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next still blocked after cancel")
+	}
+	if !errors.Is(dec.Err(), context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", dec.Err())
+	}
+}
@@ -0,0 +1,227 @@
+package streamclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// 默认的重连退避参数
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// ConnState 表示 SSEClient 的连接状态
+type ConnState int
+
+const (
+	// StateConnecting 表示正在建立第一次连接
+	StateConnecting ConnState = iota
+	// StateConnected 表示连接已建立，正在接收事件
+	StateConnected
+	// StateReconnecting 表示连接已断开，正在等待退避时间后重连
+	StateReconnecting
+	// StateClosed 表示收到了结束事件、ctx 被取消或遇到无法重试的错误，不会再重连。
+	// 带 retry 字段的 close 事件不算结束事件
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// SSEClient 持续消费一个 SSE 流：连接断开后按带抖动的指数退避自动重连，
+// 重连时携带 Last-Event-ID，只有收到 "close" 事件才会正常结束。
+// 带 retry 字段的 close 事件表示服务器只是暂时关闭（例如滚动发布时），客户端会在 retry 之后重连。
+type SSEClient struct {
+	// URL 是 SSE 端点地址
+	URL string
+	// HTTPClient 为 nil 时使用 http.DefaultClient
+	HTTPClient *http.Client
+	// InitialBackoff 是第一次重连前的等待时间，服务器通过 retry 字段给出建议时以服务器为准
+	InitialBackoff time.Duration
+	// MaxBackoff 是重连等待时间的上限
+	MaxBackoff time.Duration
+	// OnStateChange 在连接状态变化时被调用，err 是导致断开或结束的原因
+	OnStateChange func(state ConnState, err error)
+
+	lastEventID string
+	retry       time.Duration
+}
+
+// Run 连接 URL 并把每个事件交给 handle，直到收到不带 retry 字段的 "close" 事件（同样会交给 handle）、
+// ctx 被取消、服务器返回不可重试的状态码，或 handle 返回错误。
+// 收到 close 事件或服务器返回 204 时返回 nil。
+func (c *SSEClient) Run(ctx context.Context, handle func(Event) error) error {
+	attempt := 0
+	c.setState(StateConnecting, nil)
+
+	for {
+		received, err := c.connect(ctx, handle)
+		if err == nil || errors.Is(err, errStreamClosed) {
+			c.setState(StateClosed, nil)
+			return nil
+		}
+		if ctx.Err() != nil {
+			c.setState(StateClosed, ctx.Err())
+			return ctx.Err()
+		}
+		var handlerErr *errHandler
+		if errors.As(err, &handlerErr) {
+			c.setState(StateClosed, handlerErr.err)
+			return handlerErr.err
+		}
+		if !retryable(err) {
+			c.setState(StateClosed, err)
+			return err
+		}
+
+		// 上一次连接收到过事件，说明服务器恢复正常，重新从最小退避开始
+		if received {
+			attempt = 0
+		}
+		delay := c.backoff(attempt)
+		attempt++
+
+		c.setState(StateReconnecting, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.setState(StateClosed, ctx.Err())
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// LastEventID 返回最后收到的事件 ID
+func (c *SSEClient) LastEventID() string {
+	return c.lastEventID
+}
+
+// errStreamClosed 表示收到了服务器的结束事件
+var errStreamClosed = errors.New("stream closed by server")
+
+// errServerRestarting 表示服务器关闭了流，但要求客户端在 retry 之后重连
+var errServerRestarting = errors.New("stream closed by server, reconnect requested")
+
+// errHandler 包装 handle 返回的错误，这类错误不会触发重连
+type errHandler struct{ err error }
+
+func (e *errHandler) Error() string { return e.err.Error() }
+func (e *errHandler) Unwrap() error { return e.err }
+
+// connect 建立一次连接并读取事件，返回这次连接是否收到过事件
+func (c *SSEClient) connect(ctx context.Context, handle func(Event) error) (bool, error) {
+	header := http.Header{}
+	header.Set("Cache-Control", "no-cache")
+	if c.lastEventID != "" {
+		header.Set("Last-Event-ID", c.lastEventID)
+	}
+
+	body, err := openStream(ctx, c.HTTPClient, c.URL, "text/event-stream", header)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNoContent {
+			// 按规范，204 表示服务器要求客户端不要再重连
+			return false, nil
+		}
+		return false, err
+	}
+
+	reader := NewSSEReader(ctx, body)
+	reader.lastEventID = c.lastEventID
+	defer reader.Close()
+
+	// 无论连接如何结束，都保留最后的事件 ID 和服务器建议的重连间隔
+	defer func() {
+		c.lastEventID = reader.LastEventID()
+		if retry := reader.Retry(); retry > 0 {
+			c.retry = retry
+		}
+	}()
+
+	c.setState(StateConnected, nil)
+
+	received := false
+	for reader.Next() {
+		received = true
+		event := reader.Event()
+
+		if err := handle(event); err != nil {
+			return received, &errHandler{err: err}
+		}
+		if event.Type == "close" {
+			if event.Retry > 0 {
+				return received, errServerRestarting
+			}
+			return received, errStreamClosed
+		}
+	}
+
+	if err := reader.Err(); err != nil {
+		return received, err
+	}
+	return received, errors.New("stream ended without close event")
+}
+
+// backoff 计算第 attempt 次重连前的等待时间：以服务器的 retry 建议或 InitialBackoff 为基数指数增长，
+// 不超过 MaxBackoff，再在 [d/2, d] 内随机取值，避免大量客户端同时重连。到达上限后区间仍然不为空，
+// 所以抖动不会消失。重连不会早于服务器通过 retry 要求的间隔：下限被抬高到 retry 时，
+// 上限至少是 retry 的 1.5 倍，即使它因此超过 MaxBackoff。
+func (c *SSEClient) backoff(attempt int) time.Duration {
+	base := c.InitialBackoff
+	if c.retry > 0 {
+		base = c.retry
+	}
+	if base <= 0 {
+		base = defaultInitialBackoff
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	d := base
+	for i := 0; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+
+	lower, upper := d/2, d
+	if lower < c.retry {
+		lower = c.retry
+		upper = max(upper, lower+lower/2)
+	}
+	return lower + time.Duration(rand.Int63n(int64(upper-lower)+1))
+}
+
+func (c *SSEClient) setState(state ConnState, err error) {
+	if c.OnStateChange != nil {
+		c.OnStateChange(state, err)
+	}
+}
+
+// retryable 判断连接错误是否值得重连：4xx 状态码（429 除外）不会重连
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
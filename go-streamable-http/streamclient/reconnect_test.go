@@ -0,0 +1,236 @@
+package streamclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   SSEClient
+		retry    time.Duration
+		attempt  int
+		min, max time.Duration
+	}{
+		{"initial backoff", SSEClient{InitialBackoff: 100 * time.Millisecond}, 0, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"exponential growth", SSEClient{InitialBackoff: 100 * time.Millisecond}, 0, 2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped by MaxBackoff", SSEClient{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}, 0, 5, 150 * time.Millisecond, 300 * time.Millisecond},
+		{"server retry is the base", SSEClient{InitialBackoff: time.Millisecond}, 200 * time.Millisecond, 0, 200 * time.Millisecond, 300 * time.Millisecond},
+		{"server retry above MaxBackoff", SSEClient{MaxBackoff: 100 * time.Millisecond}, time.Second, 3, time.Second, 1500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			c.retry = tt.retry
+			for i := 0; i < 200; i++ {
+				if d := c.backoff(tt.attempt); d < tt.min || d > tt.max {
+					t.Fatalf("backoff(%d) = %v, want within [%v, %v]", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffJitterAtCap(t *testing.T) {
+	// 退避到达上限后，客户端之间的等待时间仍然要错开
+	tests := []struct {
+		name  string
+		retry time.Duration
+	}{
+		{"MaxBackoff reached", 0},
+		{"server retry at MaxBackoff", 300 * time.Millisecond},
+		{"server retry above MaxBackoff", time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := SSEClient{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, retry: tt.retry}
+			seen := map[time.Duration]bool{}
+			for i := 0; i < 50; i++ {
+				seen[c.backoff(10)] = true
+			}
+			if len(seen) < 2 {
+				t.Errorf("50 delays at the cap were all %v", c.backoff(10))
+			}
+		})
+	}
+}
+
+func TestSSEClientResume(t *testing.T) {
+	const retry = 50 * time.Millisecond
+
+	var (
+		mu           sync.Mutex
+		connections  int
+		disconnected time.Time
+		lastEventIDs []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections++
+		n := connections
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		waited := time.Since(disconnected)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch n {
+		case 1:
+			// 第一个连接发出一个事件后直接断开
+			fmt.Fprintf(w, "retry: %d\nid: 1\ndata: a\n\n", retry.Milliseconds())
+			mu.Lock()
+			disconnected = time.Now()
+			mu.Unlock()
+		case 2:
+			if waited < retry {
+				t.Errorf("reconnected after %v, server asked for %v", waited, retry)
+			}
+			fmt.Fprint(w, "id: 2\ndata: b\n\nevent: close\ndata: bye\n\n")
+		default:
+			t.Errorf("unexpected connection %d", n)
+		}
+	}))
+	defer srv.Close()
+
+	var states []ConnState
+	client := &SSEClient{
+		URL:            srv.URL,
+		InitialBackoff: time.Millisecond,
+		OnStateChange:  func(state ConnState, _ error) { states = append(states, state) },
+	}
+
+	var got []Event
+	err := client.Run(context.Background(), func(ev Event) error {
+		got = append(got, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []Event{{ID: "1", Type: "message", Data: "a", Retry: retry}, {ID: "2", Type: "message", Data: "b"}, {ID: "2", Type: "close", Data: "bye"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if fmt.Sprint(lastEventIDs) != fmt.Sprint([]string{"", "1"}) {
+		t.Errorf("Last-Event-ID headers = %q, want [\"\" \"1\"]", lastEventIDs)
+	}
+	wantStates := []ConnState{StateConnecting, StateConnected, StateReconnecting, StateConnected, StateClosed}
+	if fmt.Sprint(states) != fmt.Sprint(wantStates) {
+		t.Errorf("states = %v, want %v", states, wantStates)
+	}
+	if client.LastEventID() != "2" {
+		t.Errorf("LastEventID = %q, want 2", client.LastEventID())
+	}
+}
+
+func TestSSEClientReconnectsAfterShutdown(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		lastEventIDs []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastEventIDs)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if n == 1 {
+			// 服务器关闭时的 close 事件带有 retry，客户端应该重连而不是结束
+			fmt.Fprint(w, "id: 1\ndata: a\n\nretry: 10\nevent: close\ndata: Server shutting down\n\n")
+			return
+		}
+		fmt.Fprint(w, "id: 2\ndata: b\n\nevent: close\ndata: bye\n\n")
+	}))
+	defer srv.Close()
+
+	var states []ConnState
+	client := &SSEClient{URL: srv.URL, OnStateChange: func(state ConnState, _ error) { states = append(states, state) }}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []string
+	if err := client.Run(ctx, func(ev Event) error {
+		got = append(got, ev.Type+":"+ev.Data)
+		return nil
+	}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []string{"message:a", "close:Server shutting down", "message:b", "close:bye"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if fmt.Sprint(lastEventIDs) != fmt.Sprint([]string{"", "1"}) {
+		t.Errorf("Last-Event-ID headers = %q, want [\"\" \"1\"]", lastEventIDs)
+	}
+	wantStates := []ConnState{StateConnecting, StateConnected, StateReconnecting, StateConnected, StateClosed}
+	if fmt.Sprint(states) != fmt.Sprint(wantStates) {
+		t.Errorf("states = %v, want %v", states, wantStates)
+	}
+}
+
+func TestSSEClientStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int // 依次返回的状态码，之后返回 close 事件
+		wantErr     int   // 期望 Run 返回的 StatusError 状态码，0 表示返回 nil
+		connections int
+	}{
+		{"204 stops reconnecting", []int{http.StatusNoContent}, 0, 1},
+		{"404 is not retried", []int{http.StatusNotFound}, http.StatusNotFound, 1},
+		{"503 and 429 are retried", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var connections int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				connections++
+				if connections <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[connections-1])
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, "event: close\ndata: bye\n\n")
+			}))
+			defer srv.Close()
+
+			client := &SSEClient{URL: srv.URL, InitialBackoff: time.Millisecond}
+			err := client.Run(context.Background(), func(Event) error { return nil })
+
+			var statusErr *StatusError
+			switch {
+			case tt.wantErr == 0 && err != nil:
+				t.Errorf("Run = %v, want nil", err)
+			case tt.wantErr != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantErr):
+				t.Errorf("Run = %v, want status %d", err, tt.wantErr)
+			}
+			if connections != tt.connections {
+				t.Errorf("connections = %d, want %d", connections, tt.connections)
+			}
+		})
+	}
+}
+
+func TestSSEClientHandlerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: a\n\n")
+	}))
+	defer srv.Close()
+
+	stop := errors.New("stop")
+	client := &SSEClient{URL: srv.URL}
+	if err := client.Run(context.Background(), func(Event) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("Run = %v, want the handler error", err)
+	}
+}
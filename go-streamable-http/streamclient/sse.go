@@ -0,0 +1,214 @@
+package streamclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event 是一条已派发的 SSE 事件
+type Event struct {
+	// ID 是派发该事件时的 last event ID，事件本身没有 id 字段时沿用之前的值
+	ID string
+	// Type 是 event 字段的值，未设置时为 "message"
+	Type string
+	// Data 是所有 data 字段按换行符拼接后的内容
+	Data string
+	// Retry 是同一个事件块中 retry 字段的值，没有时为 0
+	Retry time.Duration
+}
+
+// SSEReader 按 HTML 规范中的 event stream 解析规则读取 SSE 事件：
+//   - 行尾可以是 CRLF、LF 或单独的 CR，开头的 BOM 会被忽略
+//   - 以冒号开头的行是注释
+//   - 字段名和值以第一个冒号分隔，值开头的一个空格会被去掉，因此 "event:x" 与 "event: x" 等价
+//   - 多个 data 字段以换行符拼接，空行派发事件，data 为空的事件不会派发
+//   - retry 字段只接受纯数字，id 字段包含 NUL 时被忽略
+//   - 流结束时尚未派发的事件被丢弃
+type SSEReader struct {
+	ctx     context.Context
+	r       io.Reader
+	scanner *bufio.Scanner
+	stop    func() bool
+	first   bool
+	skipLF  bool
+
+	lastEventID string
+	retry       time.Duration
+	eventType   string
+	eventRetry  time.Duration
+	data        strings.Builder
+	hasData     bool
+
+	event Event
+	err   error
+}
+
+// NewSSEReader 创建一个从 r 读取 SSE 事件的读取器。
+// ctx 结束时如果 r 实现了 io.Closer 会被关闭，使阻塞的读取立即返回。
+func NewSSEReader(ctx context.Context, r io.Reader) *SSEReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	s := &SSEReader{
+		ctx:     ctx,
+		r:       r,
+		scanner: scanner,
+		stop:    closeOnDone(ctx, r),
+		first:   true,
+	}
+	scanner.Split(s.scanLines)
+	return s
+}
+
+// Next 读取下一条事件，返回 false 表示流结束或出错
+func (s *SSEReader) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if s.first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			s.first = false
+		}
+
+		if line == "" {
+			if s.dispatch() {
+				return true
+			}
+			continue
+		}
+		s.processLine(line)
+	}
+
+	s.err = s.scanner.Err()
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		s.err = ctxErr
+	}
+	if s.err == nil {
+		s.err = io.EOF
+	}
+	return false
+}
+
+// processLine 处理一行非空的字段或注释
+func (s *SSEReader) processLine(line string) {
+	if strings.HasPrefix(line, ":") {
+		return
+	}
+
+	field, value, found := strings.Cut(line, ":")
+	if found {
+		value = strings.TrimPrefix(value, " ")
+	}
+
+	switch field {
+	case "event":
+		s.eventType = value
+	case "data":
+		if s.hasData {
+			s.data.WriteByte('\n')
+		}
+		s.data.WriteString(value)
+		s.hasData = true
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			s.lastEventID = value
+		}
+	case "retry":
+		if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+			s.retry = time.Duration(ms) * time.Millisecond
+			s.eventRetry = s.retry
+		}
+	}
+}
+
+// dispatch 在遇到空行时派发已缓存的事件，返回是否产生了事件
+func (s *SSEReader) dispatch() bool {
+	defer func() {
+		s.eventType = ""
+		s.eventRetry = 0
+		s.data.Reset()
+		s.hasData = false
+	}()
+
+	if !s.hasData {
+		return false
+	}
+
+	s.event = Event{ID: s.lastEventID, Type: s.eventType, Data: s.data.String(), Retry: s.eventRetry}
+	if s.event.Type == "" {
+		s.event.Type = "message"
+	}
+	return true
+}
+
+// Event 返回最近一次 Next 读取到的事件
+func (s *SSEReader) Event() Event {
+	return s.event
+}
+
+// LastEventID 返回目前为止收到的最后一个事件 ID，重连时应放到 Last-Event-ID 请求头中
+func (s *SSEReader) LastEventID() string {
+	return s.lastEventID
+}
+
+// Retry 返回服务器通过 retry 字段建议的重连间隔，未收到时为 0
+func (s *SSEReader) Retry() time.Duration {
+	return s.retry
+}
+
+// Err 返回导致读取结束的错误，流正常结束时返回 nil
+func (s *SSEReader) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// Close 关闭底层的 reader（如果它实现了 io.Closer）
+func (s *SSEReader) Close() error {
+	s.stop()
+	if closer, ok := s.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// scanLines 是支持 CRLF、LF 和单独 CR 作为行尾的 bufio.SplitFunc。
+// 遇到缓冲区末尾的 CR 时立即返回该行，而不是等待下一个字节，避免延迟事件派发；
+// 如果随后读到的第一个字节是 LF，则把它作为 CRLF 的一部分跳过。
+func (s *SSEReader) scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if s.skipLF && len(data) > 0 {
+		s.skipLF = false
+		if data[0] == '\n' {
+			return 1, nil, nil
+		}
+	}
+
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) {
+				s.skipLF = true
+			} else if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		// 流结束时没有行尾的内容不构成完整的行，按规范直接丢弃
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
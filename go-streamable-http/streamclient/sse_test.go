@@ -0,0 +1,108 @@
+package streamclient
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      []Event
+		lastID    string
+		wantRetry time.Duration
+	}{
+		{
+			name:  "single event",
+			input: "id: 1\nevent: update\ndata: hello\n\n",
+			want:  []Event{{ID: "1", Type: "update", Data: "hello"}},
+		},
+		{
+			name:  "default type and multi-line data",
+			input: "data: first\ndata: second\n\n",
+			want:  []Event{{Type: "message", Data: "first\nsecond"}},
+		},
+		{
+			name:  "CRLF and lone CR line endings",
+			input: "data: a\r\n\r\ndata: b\r\rdata: c\n\n",
+			want:  []Event{{Type: "message", Data: "a"}, {Type: "message", Data: "b"}, {Type: "message", Data: "c"}},
+		},
+		{
+			name:  "BOM, comments and field without space",
+			input: "\ufeff: comment\nevent:x\ndata:y\n\n",
+			want:  []Event{{Type: "x", Data: "y"}},
+		},
+		{
+			name:  "field without colon",
+			input: "data\ndata\n\n",
+			want:  []Event{{Type: "message", Data: "\n"}},
+		},
+		{
+			name:  "id is kept for later events",
+			input: "id: 7\ndata: a\n\ndata: b\n\n",
+			want:  []Event{{ID: "7", Type: "message", Data: "a"}, {ID: "7", Type: "message", Data: "b"}},
+		},
+		{
+			name:   "id with NUL is ignored",
+			input:  "id: 1\ndata: a\n\nid: 2\x00\ndata: b\n\n",
+			want:   []Event{{ID: "1", Type: "message", Data: "a"}, {ID: "1", Type: "message", Data: "b"}},
+			lastID: "1",
+		},
+		{
+			name:      "retry accepts only digits",
+			input:     "retry: 250\nretry: 1s\nretry: -1\ndata: a\n\n",
+			want:      []Event{{Type: "message", Data: "a", Retry: 250 * time.Millisecond}},
+			wantRetry: 250 * time.Millisecond,
+		},
+		{
+			name:      "event retry covers only its own block",
+			input:     "retry: 100\n\ndata: a\n\nretry: 200\nevent: close\ndata: b\n\n",
+			want:      []Event{{Type: "message", Data: "a"}, {Type: "close", Data: "b", Retry: 200 * time.Millisecond}},
+			wantRetry: 200 * time.Millisecond,
+		},
+		{
+			name:   "event without data is not dispatched",
+			input:  "id: 3\nevent: ping\n\ndata: a\n\n",
+			want:   []Event{{ID: "3", Type: "message", Data: "a"}},
+			lastID: "3",
+		},
+		{
+			name:  "incomplete event at end of stream is dropped",
+			input: "data: a\n\nid: 9\ndata: partial",
+			want:  []Event{{Type: "message", Data: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 逐字节读取，覆盖 CR 落在缓冲区末尾、随后才读到 LF 的情况
+			r := NewSSEReader(context.Background(), iotest.OneByteReader(strings.NewReader(tt.input)))
+			var got []Event
+			for r.Next() {
+				got = append(got, r.Event())
+			}
+			if err := r.Err(); err != nil {
+				t.Fatalf("Err = %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("events = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if tt.lastID != "" && r.LastEventID() != tt.lastID {
+				t.Errorf("LastEventID = %q, want %q", r.LastEventID(), tt.lastID)
+			}
+			if r.Retry() != tt.wantRetry {
+				t.Errorf("Retry = %v, want %v", r.Retry(), tt.wantRetry)
+			}
+		})
+	}
+}
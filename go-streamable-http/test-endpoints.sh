@@ -21,11 +21,27 @@ echo ""
 echo ""
 
 echo "3. 测试 Server-Sent Events..."
-echo "curl $BASE_URL/sse"
+echo "curl $BASE_URL/sse?limit=5"
 echo "----------------------------------------"
-timeout 8s curl -s "$BASE_URL/sse" || echo "已超时停止"
+timeout 8s curl -s "$BASE_URL/sse?limit=5" || echo "已超时停止"
 echo ""
 echo ""
 
+echo "4. 测试主题发布/订阅..."
+echo "curl $BASE_URL/sse?topic=news&limit=1 + curl -X POST $BASE_URL/publish/news"
+echo "----------------------------------------"
+timeout 5s curl -s "$BASE_URL/sse?topic=news&limit=1" &
+sleep 1
+curl -s -X POST -d '{"headline":"hello"}' "$BASE_URL/publish/news"
+wait
+echo ""
+echo ""
+
+echo "5. 测试多路合并..."
+echo "curl $BASE_URL/sse/mux?source=json?count=3&source=text?interval=100ms%26timeout=1s"
+echo "----------------------------------------"
+timeout 8s curl -s "$BASE_URL/sse/mux?source=json?count=3&source=text?interval=100ms%26timeout=1s" || echo "已超时停止"
+echo ""
+
 echo "✅ 所有端点测试完成！"
 echo "💡 提示：访问 $BASE_URL 查看交互式网页界面"
@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+// streamTicker 决定流式处理器什么时候发送下一条消息
+type streamTicker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// newStreamTicker 创建流式处理器的节拍器。测试会替换它，由测试决定每次 tick 的时机，
+// 这样既不用真的等待，也能确认每条消息在处理器开始等待之前已经刷新给客户端。
+var newStreamTicker = func(d time.Duration) streamTicker {
+	return timeTicker{time.NewTicker(d)}
+}
+
+// timeTicker 用 time.Ticker 实现 streamTicker
+type timeTicker struct {
+	t *time.Ticker
+}
+
+func (t timeTicker) C() <-chan time.Time   { return t.t.C }
+func (t timeTicker) Reset(d time.Duration) { t.t.Reset(d) }
+func (t timeTicker) Stop()                 { t.t.Stop() }
@@ -5,4 +5,6 @@ type StreamData struct {
 	Timestamp int64  `json:"timestamp"`
 	Message   string `json:"message"`
 	Count     int    `json:"count"`
+	// Final 为 true 表示服务器即将关闭，这是流中的最后一条消息
+	Final bool `json:"final,omitempty"`
 }
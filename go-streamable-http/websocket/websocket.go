@@ -0,0 +1,318 @@
+// Package websocket 是基于标准库 Hijacker 实现的最小 WebSocket (RFC 6455) 服务端，
+// 只支持本仓库的服务需要的功能：文本/二进制消息、分片消息、ping/pong 和关闭握手，
+// 不支持扩展和子协议。go-streamable-http 的 /ws 和 json-rpc-demo 的 /ws 都使用它。
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 6455 规定的握手 GUID
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize 是单条消息的最大长度
+const MaxMessageSize = 1 << 20
+
+// WebSocket 操作码
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// WebSocket 关闭状态码
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseTooBig          = 1009
+)
+
+// ErrClosed 表示对端发起了关闭握手
+var ErrClosed = errors.New("websocket closed by peer")
+
+// ProtocolError 表示对端违反了协议，连接已经以 Code 关闭
+type ProtocolError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("websocket protocol error %d: %s", e.Code, e.Reason)
+}
+
+// Conn 是一个已完成握手的 WebSocket 连接。读操作只能在一个 goroutine 中进行，写操作是并发安全的。
+type Conn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	writeMu sync.Mutex
+	closed  bool
+
+	// OnPong 在收到 pong 帧时被调用，需要在开始读取之前设置
+	OnPong func()
+	// OnClose 在底层连接关闭时被调用一次，需要在连接交给其他 goroutine 之前设置
+	OnClose func()
+}
+
+// Upgrade 校验握手请求并接管底层连接。失败时已经向客户端写出了错误响应。
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "websocket handshake requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("handshake method is not GET")
+	}
+	if r.ProtoMajor != 1 {
+		http.Error(w, "websocket requires HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return nil, errors.New("handshake is not HTTP/1.1")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected websocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("missing upgrade headers")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("invalid Sec-WebSocket-Key")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("hijack connection: %w", err)
+	}
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(handshake); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write handshake: %w", err)
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write handshake: %w", err)
+	}
+
+	// Hijack 之后服务器设置的超时不再生效，清除可能残留的截止时间
+	conn.SetDeadline(time.Time{})
+	return &Conn{conn: conn, br: rw.Reader}, nil
+}
+
+// acceptKey 按 RFC 6455 第 4.2.2 节由 Sec-WebSocket-Key 计算 Sec-WebSocket-Accept
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken 判断逗号分隔的请求头中是否包含指定的 token（不区分大小写）
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage 读取下一条完整的数据消息，返回操作码（OpText 或 OpBinary）和内容。
+// ping 会自动回复 pong，收到关闭帧时回复关闭帧并返回 ErrClosed，
+// 违反协议时以对应状态码关闭连接并返回 *ProtocolError。
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			var protoErr *ProtocolError
+			if errors.As(err, &protoErr) {
+				c.Close(protoErr.Code, protoErr.Reason)
+			}
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			if c.OnPong != nil {
+				c.OnPong()
+			}
+			continue
+		case OpClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(code, "")
+			return 0, nil, ErrClosed
+		case OpText, OpBinary:
+			if message != nil {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			opcode = op
+			message = payload
+		case OpContinuation:
+			if message == nil {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+			if len(message)+len(payload) > MaxMessageSize {
+				return 0, nil, c.fail(CloseTooBig, "message too big")
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// fail 以 code 关闭连接并返回对应的 *ProtocolError
+func (c *Conn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &ProtocolError{code, reason}
+}
+
+// readFrame 读取一个帧并去掉掩码。客户端发来的帧必须带掩码。
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &ProtocolError{CloseProtocolError, "reserved bits set"}
+	}
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	if !masked {
+		return false, 0, nil, &ProtocolError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode >= OpClose && (length > 125 || !fin) {
+		return false, 0, nil, &ProtocolError{CloseProtocolError, "invalid control frame"}
+	}
+	if length > MaxMessageSize {
+		return false, 0, nil, &ProtocolError{CloseTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame 写出一个不分片、不带掩码的帧
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// WriteText 发送一条文本消息
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(OpText, data)
+}
+
+// Ping 发送一个 ping 帧
+func (c *Conn) Ping() error {
+	return c.writeFrame(OpPing, nil)
+}
+
+// Close 发送关闭帧并关闭底层连接，可以重复调用，也可以与其他写操作并发调用。
+// 关闭帧在写锁下整帧写出，不会截断正在发送的消息。
+func (c *Conn) Close(code int, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+	c.writeFrame(OpClose, payload)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.conn.Close()
+		if c.OnClose != nil {
+			c.OnClose()
+		}
+	}
+}
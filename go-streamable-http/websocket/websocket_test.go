@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// frame 构造一个客户端帧，mask 为 false 时不带掩码
+func frame(fin bool, opcode int, payload string, mask bool) []byte {
+	b := []byte{byte(opcode), byte(len(payload))}
+	if fin {
+		b[0] |= 0x80
+	}
+	if !mask {
+		return append(b, payload...)
+	}
+	b[1] |= 0x80
+	key := []byte{1, 2, 3, 4}
+	b = append(b, key...)
+	for i := 0; i < len(payload); i++ {
+		b = append(b, payload[i]^key[i%4])
+	}
+	return b
+}
+
+// echoServer 把收到的每条消息原样发回，并记录 ReadMessage 最后返回的错误和 OnClose 的调用次数
+func echoServer(t *testing.T) (addr string, readErr chan error, closes *atomic.Int32) {
+	t.Helper()
+	readErr = make(chan error, 1)
+	closes = new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.OnClose = func() { closes.Add(1) }
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				conn.Close(CloseNormal, "")
+				readErr <- err
+				return
+			}
+			conn.WriteText(msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), readErr, closes
+}
+
+// dial 完成握手，返回连接和读取服务端帧的 reader
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 6455 第 1.3 节的示例
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake = %d %q", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return conn, br
+}
+
+// readFrame 读取一个服务端帧
+func readFrame(t *testing.T, br *bufio.Reader) (int, string) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	payload := make([]byte, header[1]&0x7F)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return int(header[0] & 0x0F), string(payload)
+}
+
+func TestConn(t *testing.T) {
+	addr, readErr, closes := echoServer(t)
+	conn, br := dial(t, addr)
+
+	// 分片消息中间插入的 ping 先得到回复，然后整条消息被拼接后回显
+	conn.Write(frame(false, OpText, "hel", true))
+	conn.Write(frame(true, OpPing, "p", true))
+	conn.Write(frame(true, OpContinuation, "lo", true))
+	if op, payload := readFrame(t, br); op != OpPong || payload != "p" {
+		t.Errorf("got opcode %d %q, want pong \"p\"", op, payload)
+	}
+	if op, payload := readFrame(t, br); op != OpText || payload != "hello" {
+		t.Errorf("got opcode %d %q, want text \"hello\"", op, payload)
+	}
+
+	// 关闭帧被回显，ReadMessage 报告 ErrClosed
+	conn.Write(frame(true, OpClose, "\x03\xe8", true))
+	if op, payload := readFrame(t, br); op != OpClose || payload != "\x03\xe8" {
+		t.Errorf("got opcode %d %q, want close 1000", op, payload)
+	}
+	if err := <-readErr; !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadMessage = %v, want ErrClosed", err)
+	}
+	if n := closes.Load(); n != 1 {
+		t.Errorf("OnClose called %d times, want 1", n)
+	}
+}
+
+func TestConnProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		code   int
+	}{
+		{"unmasked frame", [][]byte{frame(true, OpText, "a", false)}, CloseProtocolError},
+		{"reserved bits", [][]byte{append([]byte{0xC1}, frame(true, OpText, "a", true)[1:]...)}, CloseProtocolError},
+		{"unknown opcode", [][]byte{frame(true, 0x3, "a", true)}, CloseProtocolError},
+		{"fragmented control frame", [][]byte{frame(false, OpPing, "", true)}, CloseProtocolError},
+		{"unexpected continuation", [][]byte{frame(true, OpContinuation, "a", true)}, CloseProtocolError},
+		{"missing continuation", [][]byte{frame(false, OpText, "a", true), frame(true, OpText, "b", true)}, CloseProtocolError},
+		{"too big", [][]byte{{0x81, 0xFF, 0, 0, 0, 0, 0, 0x20, 0, 0}}, CloseTooBig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, readErr, _ := echoServer(t)
+			conn, br := dial(t, addr)
+			for _, f := range tt.frames {
+				conn.Write(f)
+			}
+
+			op, payload := readFrame(t, br)
+			if op != OpClose || len(payload) < 2 || int(binary.BigEndian.Uint16([]byte(payload))) != tt.code {
+				t.Errorf("got opcode %d %q, want close %d", op, payload, tt.code)
+			}
+			var protoErr *ProtocolError
+			if err := <-readErr; !errors.As(err, &protoErr) || protoErr.Code != tt.code {
+				t.Errorf("ReadMessage = %v, want a protocol error %d", err, tt.code)
+			}
+		})
+	}
+}
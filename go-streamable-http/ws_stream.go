@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go-streamable-http/websocket"
+)
+
+// WebSocket 保活参数：每隔 wsPingInterval 发送一次 ping，超过 wsPongTimeout 没有收到 pong 则断开
+const (
+	wsPingInterval = 20 * time.Second
+	wsPongTimeout  = 2 * wsPingInterval
+)
+
+// wsCommand 是客户端发送的控制消息，例如
+// {"type":"pause"}、{"type":"resume"}、{"type":"set-interval","interval":"250ms"}
+type wsCommand struct {
+	Type     string `json:"type"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// wsReply 是服务器对控制消息的确认或错误
+type wsReply struct {
+	Type     string `json:"type"`
+	Command  string `json:"command,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// WebSocket 处理器：推送与 /stream/json 相同的 StreamData 消息，
+// 并接受 pause、resume、set-interval 控制消息
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfDraining(w) {
+		return
+	}
+
+	// count 为 0 表示一直推送，直到客户端断开
+	count := 0
+	if countParam := r.URL.Query().Get("count"); countParam != "" {
+		if c, err := strconv.Atoi(countParam); err == nil && c > 0 {
+			count = c
+		}
+	}
+	interval := 500 * time.Millisecond
+	if d, ok := parseDurationParam(r, "interval"); ok {
+		interval = clampInterval(d)
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	hijacked.track(conn)
+
+	var lastPong atomic.Int64
+	lastPong.Store(time.Now().UnixNano())
+	conn.OnPong = func() { lastPong.Store(time.Now().UnixNano()) }
+
+	// 读取 goroutine：解析控制消息，连接断开时通过 readDone 通知，处理器返回时通过 done 退出
+	commands := make(chan wsCommand)
+	readDone := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			opcode, message, err := conn.ReadMessage()
+			if err != nil {
+				readDone <- err
+				return
+			}
+			if opcode != websocket.OpText {
+				conn.Close(websocket.CloseUnsupportedData, "control messages must be text")
+				readDone <- errors.New("binary message received")
+				return
+			}
+
+			var cmd wsCommand
+			if err := json.Unmarshal(message, &cmd); err != nil {
+				writeWSJSON(conn, wsReply{Type: "error", Error: "invalid control message"})
+				continue
+			}
+			select {
+			case commands <- cmd:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := newStreamTicker(interval)
+	defer ticker.Stop()
+	pingTicker := time.NewTicker(wsPingInterval)
+	defer pingTicker.Stop()
+
+	paused := false
+	sent := 0
+	send := func() error {
+		sent++
+		return writeWSJSON(conn, StreamData{
+			Timestamp: time.Now().Unix(),
+			Message:   fmt.Sprintf("Stream message #%d", sent),
+			Count:     sent,
+		})
+	}
+
+	// 与 /stream/json 一样，第一条消息立即发送
+	if err := send(); err != nil {
+		log.Printf("Error writing WebSocket message: %v", err)
+		conn.Close(websocket.CloseNormal, "")
+		return
+	}
+
+	for count == 0 || sent < count {
+		select {
+		case err := <-readDone:
+			if !errors.Is(err, websocket.ErrClosed) && !errors.Is(err, io.EOF) {
+				log.Printf("WebSocket read error after %d messages: %v", sent, err)
+			} else {
+				log.Printf("WebSocket client went away after delivering %d messages", sent)
+			}
+			conn.Close(websocket.CloseNormal, "")
+			return
+
+		case <-draining:
+			writeWSJSON(conn, StreamData{Timestamp: time.Now().Unix(), Message: "server shutting down", Count: sent, Final: true})
+			conn.Close(websocket.CloseGoingAway, "server shutting down")
+			log.Printf("WebSocket closed for shutdown after delivering %d messages", sent)
+			return
+
+		case cmd := <-commands:
+			reply := wsReply{Type: "ack", Command: cmd.Type}
+			switch cmd.Type {
+			case "pause":
+				paused = true
+			case "resume":
+				paused = false
+			case "set-interval":
+				d, err := parseDuration(cmd.Interval)
+				if err != nil {
+					reply = wsReply{Type: "error", Command: cmd.Type, Error: err.Error()}
+					break
+				}
+				interval = clampInterval(d)
+				ticker.Reset(interval)
+				reply.Interval = interval.String()
+			default:
+				reply = wsReply{Type: "error", Command: cmd.Type, Error: "unknown command"}
+			}
+			if err := writeWSJSON(conn, reply); err != nil {
+				log.Printf("Error writing WebSocket reply: %v", err)
+				conn.Close(websocket.CloseNormal, "")
+				return
+			}
+
+		case <-ticker.C():
+			if paused {
+				continue
+			}
+			if err := send(); err != nil {
+				log.Printf("Error writing WebSocket message after %d messages: %v", sent-1, err)
+				conn.Close(websocket.CloseNormal, "")
+				return
+			}
+
+		case <-pingTicker.C:
+			if time.Since(time.Unix(0, lastPong.Load())) > wsPongTimeout {
+				log.Printf("WebSocket client stopped answering pings after %d messages", sent)
+				conn.Close(websocket.CloseGoingAway, "pong timeout")
+				return
+			}
+			if err := conn.Ping(); err != nil {
+				log.Printf("Error sending WebSocket ping: %v", err)
+				conn.Close(websocket.CloseNormal, "")
+				return
+			}
+		}
+	}
+
+	conn.Close(websocket.CloseNormal, "stream complete")
+}
+
+// writeWSJSON 把 v 编码为 JSON 并作为文本消息发送
+func writeWSJSON(conn *websocket.Conn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return conn.WriteText(data)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go-streamable-http/websocket"
+)
+
+// wsTestClient 是测试用的最小 WebSocket 客户端：发送带掩码的帧，读取服务端的未分片帧
+type wsTestClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWS(t *testing.T, serverURL, query string) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(testTimeout))
+
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	fmt.Fprintf(conn, "GET /%s HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", query, key)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+	if got, want := resp.Header.Get("Sec-WebSocket-Accept"), wsAcceptKey(key); got != want {
+		t.Fatalf("Sec-WebSocket-Accept = %q, want %q", got, want)
+	}
+	return &wsTestClient{conn: conn, br: br}
+}
+
+// wsAcceptKey 按 RFC 6455 第 4.2.2 节计算握手响应中的 Sec-WebSocket-Accept
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readFrame 读取一个服务端帧，返回操作码和负载
+func (c *wsTestClient) readFrame(t *testing.T) (int, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		t.Fatalf("read frame header: %v", err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("server frame must be final and unmasked, got header %x", header)
+	}
+
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		t.Fatal("unexpected 64-bit frame length")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatalf("read frame payload: %v", err)
+	}
+	return int(header[0] & 0x0F), payload
+}
+
+// readJSON 读取一个文本帧并解码为 v
+func (c *wsTestClient) readJSON(t *testing.T, v interface{}) {
+	t.Helper()
+	opcode, payload := c.readFrame(t)
+	if opcode != websocket.OpText {
+		t.Fatalf("opcode = %d, want text (payload %q)", opcode, payload)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		t.Fatalf("decode %q: %v", payload, err)
+	}
+}
+
+// writeText 发送一个带掩码的文本帧
+func (c *wsTestClient) writeText(t *testing.T, payload string) {
+	t.Helper()
+	if len(payload) > 125 {
+		t.Fatal("test payload too long")
+	}
+	frame := []byte{0x80 | websocket.OpText, 0x80 | byte(len(payload)), 1, 2, 3, 4}
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^frame[2+i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectClose 检查服务端以指定状态码发送关闭帧
+func (c *wsTestClient) expectClose(t *testing.T, code int) {
+	t.Helper()
+	opcode, payload := c.readFrame(t)
+	if opcode != websocket.OpClose || len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+		t.Fatalf("got opcode %d payload %q, want close %d", opcode, payload, code)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	clock := useManualTicker(t)
+	srv := newTestServer(t, wsHandler)
+
+	client := dialWS(t, srv.URL, "?count=3")
+	ticker := clock.next(t)
+
+	for i := 1; i <= 3; i++ {
+		var data StreamData
+		client.readJSON(t, &data)
+		if data.Count != i || data.Message != fmt.Sprintf("Stream message #%d", i) {
+			t.Fatalf("message %d = %+v", i, data)
+		}
+		if i == 1 {
+			// 控制消息在两条数据之间得到确认
+			for _, tt := range []struct {
+				command string
+				want    wsReply
+			}{
+				{`{"type":"pause"}`, wsReply{Type: "ack", Command: "pause"}},
+				{`{"type":"resume"}`, wsReply{Type: "ack", Command: "resume"}},
+				{`{"type":"set-interval","interval":"1ms"}`, wsReply{Type: "ack", Command: "set-interval", Interval: minStreamInterval.String()}},
+				{`{"type":"set-interval","interval":"soon"}`, wsReply{Type: "error", Command: "set-interval", Error: `invalid duration "soon"`}},
+				{`{"type":"rewind"}`, wsReply{Type: "error", Command: "rewind", Error: "unknown command"}},
+			} {
+				client.writeText(t, tt.command)
+				var reply wsReply
+				client.readJSON(t, &reply)
+				if reply != tt.want {
+					t.Errorf("%s: reply = %+v, want %+v", tt.command, reply, tt.want)
+				}
+			}
+		}
+		if i < 3 {
+			ticker.tick(t)
+		}
+	}
+	client.expectClose(t, websocket.CloseNormal)
+}
+
+func TestWebSocketPause(t *testing.T) {
+	clock := useManualTicker(t)
+	srv := newTestServer(t, wsHandler)
+
+	client := dialWS(t, srv.URL, "?count=2")
+	ticker := clock.next(t)
+
+	var data StreamData
+	client.readJSON(t, &data)
+
+	client.writeText(t, `{"type":"pause"}`)
+	var reply wsReply
+	client.readJSON(t, &reply)
+
+	// 暂停期间的 tick 不发送消息，恢复后的下一个 tick 才发送第二条
+	ticker.tick(t)
+	client.writeText(t, `{"type":"resume"}`)
+	client.readJSON(t, &reply)
+	if reply.Command != "resume" {
+		t.Fatalf("expected resume ack before the next message, got %+v", reply)
+	}
+	ticker.tick(t)
+	client.readJSON(t, &data)
+	if data.Count != 2 {
+		t.Fatalf("second message = %+v", data)
+	}
+	client.expectClose(t, websocket.CloseNormal)
+}
+
+func TestWebSocketRejectsPlainHTTP(t *testing.T) {
+	srv := newTestServer(t, wsHandler)
+
+	resp, err := testClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	// 之前的测试关闭的连接可能还没有从记录中移除，先等它们结束
+	settle, cancelSettle := context.WithTimeout(context.Background(), testTimeout)
+	defer cancelSettle()
+	hijacked.wait(settle)
+
+	clock := useManualTicker(t)
+	srv := newTestServer(t, wsHandler)
+
+	client := dialWS(t, srv.URL, "")
+	clock.next(t)
+	var data StreamData
+	client.readJSON(t, &data)
+
+	// 升级后的连接被记录下来，直到关闭
+	if n := len(hijacked.snapshot()); n != 1 {
+		t.Fatalf("tracked connections = %d, want 1", n)
+	}
+
+	// 处理器一直在等待下一个 tick，wait 超时后以 1001 强制关闭连接
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if n := hijacked.wait(ctx); n != 1 {
+		t.Errorf("wait closed %d connections, want 1", n)
+	}
+	client.expectClose(t, websocket.CloseGoingAway)
+	if n := len(hijacked.snapshot()); n != 0 {
+		t.Errorf("tracked connections after close = %d, want 0", n)
+	}
+}
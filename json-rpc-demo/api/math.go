@@ -0,0 +1,26 @@
+// Package api holds JSON-RPC service definitions that the server and its
+// clients share. rpcgen turns each interface into a typed client stub in this
+// package and registration glue for the server, so both sides always agree on
+// method names, params and results.
+package api
+
+import "context"
+
+//go:generate go run ../cmd/rpcgen -type Math -prefix math -client math_client_gen.go -server ../server/math_rpc_gen.go
+
+// Math is the math.* part of the demo server.
+type Math interface {
+	// Add returns a + b.
+	Add(ctx context.Context, params AddParams) (SumResult, error)
+	// Sum adds up all numbers; they are passed as positional params.
+	Sum(ctx context.Context, values []float64) (SumResult, error)
+}
+
+type AddParams struct {
+	A float64 `json:"a,required"`
+	B float64 `json:"b,required"`
+}
+
+type SumResult struct {
+	Sum float64 `json:"sum"`
+}
@@ -0,0 +1,35 @@
+// Code generated by rpcgen from api.Math. DO NOT EDIT.
+
+package api
+
+import (
+	"context"
+
+	rpcclient "json-rpc-demo/rpcclient"
+)
+
+// MathClient calls the Math methods on a JSON-RPC server.
+type MathClient struct {
+	client *rpcclient.Client
+}
+
+// NewMathClient returns a Math that sends every call through client.
+func NewMathClient(client *rpcclient.Client) *MathClient {
+	return &MathClient{client: client}
+}
+
+var _ Math = (*MathClient)(nil)
+
+// Add calls math.add.
+func (c *MathClient) Add(ctx context.Context, params AddParams) (SumResult, error) {
+	var result SumResult
+	err := c.client.Call(ctx, "math.add", params, &result)
+	return result, err
+}
+
+// Sum calls math.sum.
+func (c *MathClient) Sum(ctx context.Context, params []float64) (SumResult, error) {
+	var result SumResult
+	err := c.client.Call(ctx, "math.sum", params, &result)
+	return result, err
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,27 +12,10 @@ import (
 	"net/http"
 	"os"
 	"time"
-)
-
-type rpcRequest struct {
-	JSONRPC string `json:"jsonrpc"`
-	Method  string `json:"method"`
-	Params  any    `json:"params,omitempty"`
-	ID      any    `json:"id,omitempty"`
-}
-
-type rpcResponse struct {
-	JSONRPC string          `json:"jsonrpc"`
-	Result  json.RawMessage `json:"result,omitempty"`
-	Error   *rpcError       `json:"error,omitempty"`
-	ID      any             `json:"id,omitempty"`
-}
 
-type rpcError struct {
-	Code    int             `json:"code"`
-	Message string          `json:"message"`
-	Data    json.RawMessage `json:"data,omitempty"`
-}
+	"json-rpc-demo/api"
+	"json-rpc-demo/rpcclient"
+)
 
 func main() {
 	endpoint := flag.String("server", "http://localhost:8080/rpc", "JSON-RPC endpoint URL")
@@ -38,127 +23,155 @@ func main() {
 
 	log.SetFlags(0)
 
+	client := rpcclient.New(*endpoint)
+	client.HTTPClient = &http.Client{Transport: printTransport{http.DefaultTransport}}
+	math := api.NewMathClient(client)
+
 	examples := []struct {
-		title  string
-		req    rpcRequest
-		isNote bool
+		title string
+		run   func(ctx context.Context) error
 	}{
 		{
 			title: "Add two numbers (object params)",
-			req: rpcRequest{
-				JSONRPC: "2.0",
-				Method:  "math.add",
-				Params: map[string]any{
-					"a": 2,
-					"b": 3,
-				},
-				ID: 1,
+			run: func(ctx context.Context) error {
+				// the stub generated from api.Math shares its types with the server
+				sum, err := math.Add(ctx, api.AddParams{A: 2, B: 3})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("math.add(2, 3) = %v\n", sum.Sum)
+				return nil
 			},
 		},
 		{
 			title: "Sum a slice of numbers (positional params)",
-			req: rpcRequest{
-				JSONRPC: "2.0",
-				Method:  "math.sum",
-				Params:  []float64{1, 2, 3, 4.5},
-				ID:      2,
+			run: func(ctx context.Context) error {
+				sum, err := math.Sum(ctx, []float64{1, 2, 3, 4.5})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("math.sum(1, 2, 3, 4.5) = %v\n", sum.Sum)
+				return nil
 			},
 		},
 		{
 			title: "Send a notification (no response expected)",
-			req: rpcRequest{
-				JSONRPC: "2.0",
-				Method:  "text.concat",
-				Params: map[string]any{
+			run: func(ctx context.Context) error {
+				return client.Notify(ctx, "text.concat", map[string]any{
 					"parts":     []string{"hello", "json-rpc"},
 					"separator": ", ",
-				},
+				})
 			},
-			isNote: true,
 		},
 		{
 			title: "Trigger an error (unknown method)",
-			req: rpcRequest{
-				JSONRPC: "2.0",
-				Method:  "math.divide",
-				Params:  map[string]any{"a": 4, "b": 0},
-				ID:      3,
+			run: func(ctx context.Context) error {
+				err := client.Call(ctx, "math.divide", map[string]any{"a": 4, "b": 0}, nil)
+				printRPCError(err)
+				return nil
 			},
 		},
+		{
+			title: "Send a batch",
+			run:   batchCalls(client),
+		},
 	}
 
 	for _, example := range examples {
 		fmt.Println("\n==>", example.title)
-		if err := sendRequest(*endpoint, example.req, example.isNote); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := example.run(ctx); err != nil {
 			log.Printf("request failed: %v", err)
 		}
+		cancel()
 		time.Sleep(200 * time.Millisecond)
 	}
 }
 
-func sendRequest(endpoint string, req rpcRequest, isNotification bool) error {
-	encoded, err := json.MarshalIndent(req, "", "  ")
-	if err != nil {
-		return fmt.Errorf("encode request: %w", err)
+// batchCalls sends two calls in one request; each succeeds or fails on its own.
+func batchCalls(client *rpcclient.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var text struct {
+			Text string `json:"text"`
+		}
+		batch := client.NewBatch()
+		concat := batch.Call("text.concat", map[string]any{"parts": []string{"typed", "batch"}}, &text)
+		divide := batch.Call("math.divide", []float64{4, 0}, nil)
+		if err := batch.Send(ctx); err != nil {
+			return err
+		}
+		if err := concat.Err(); err != nil {
+			return err
+		}
+		fmt.Printf("text.concat in a batch = %q\n", text.Text)
+		printRPCError(divide.Err())
+		return nil
 	}
+}
 
-	fmt.Println("Request:")
-	fmt.Println(string(encoded))
-
-	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(encoded))
-	if err != nil {
-		return fmt.Errorf("create http request: %w", err)
+// printRPCError shows the error object the server returned, if err wraps one.
+func printRPCError(err error) {
+	var rpcErr *rpcclient.Error
+	if !errors.As(err, &rpcErr) {
+		if err != nil {
+			log.Printf("request failed: %v", err)
+		}
+		return
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("send request: %w", err)
+	fmt.Printf("Server returned JSON-RPC error (code %d): %s\n", rpcErr.Code, rpcErr.Message)
+	if len(rpcErr.Data) > 0 {
+		fmt.Printf("Error data: %s\n", rpcErr.Data)
 	}
-	defer resp.Body.Close()
+}
 
-	if isNotification {
-		fmt.Printf("Response status: %d %s (notifications omit bodies)\n", resp.StatusCode, resp.Status)
-		io.Copy(io.Discard, resp.Body)
-		return nil
-	}
+// printTransport prints every request and response body, so the demo shows
+// the JSON-RPC messages that rpcclient sends and receives.
+type printTransport struct {
+	next http.RoundTripper
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (t printTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
 	if err != nil {
-		return fmt.Errorf("read response: %w", err)
-	}
-
-	fmt.Printf("Response status: %d %s\n", resp.StatusCode, resp.Status)
-	if len(body) == 0 {
-		fmt.Println("(no response body)")
-		return nil
+		return nil, fmt.Errorf("read request: %w", err)
 	}
+	fmt.Println("Request:")
+	printJSON(body)
 
-	var rpcResp rpcResponse
-	if err := json.Unmarshal(body, &rpcResp); err != nil {
-		fmt.Println("Raw response:")
-		fmt.Println(string(body))
-		return fmt.Errorf("decode JSON-RPC response: %w", err)
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
 	}
 
-	pretty, err := json.MarshalIndent(rpcResp, "", "  ")
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
 	if err != nil {
-		fmt.Println("Raw response:")
-		fmt.Println(string(body))
-		return fmt.Errorf("pretty-print response: %w", err)
+		return nil, fmt.Errorf("read response: %w", err)
 	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
 
-	fmt.Println("Response body:")
-	fmt.Println(string(pretty))
-
-	if rpcResp.Error != nil {
-		fmt.Printf("Server returned JSON-RPC error (code %d): %s\n", rpcResp.Error.Code, rpcResp.Error.Message)
-		if len(rpcResp.Error.Data) > 0 {
-			fmt.Printf("Error data: %s\n", string(rpcResp.Error.Data))
-		}
+	fmt.Printf("Response status: %s\n", resp.Status)
+	if len(bytes.TrimSpace(body)) == 0 {
+		fmt.Println("(no response body)")
+	} else {
+		fmt.Println("Response body:")
+		printJSON(body)
 	}
+	return resp, nil
+}
 
-	return nil
+// printJSON prints data indented, or as it is if it is not JSON.
+func printJSON(data []byte) {
+	data = bytes.TrimSpace(data)
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, data, "", "  "); err != nil {
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Println(pretty.String())
 }
 
 func init() {
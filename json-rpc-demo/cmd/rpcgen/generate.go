@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// service is an interface that rpcgen generates code for.
+// The fields are exported for the templates.
+type service struct {
+	Pkg     string // package of the interface
+	Name    string
+	Methods []method
+	Imports []string // import specs the client stub needs for the method types
+}
+
+type method struct {
+	GoName     string
+	RPCName    string // set from the doc comment or by setNames
+	ParamType  string
+	ResultType string
+}
+
+// parseService finds the interface typeName among the Go files in dir,
+// skipping tests and the files rpcgen itself writes.
+func parseService(dir, typeName string, skip ...string) (*service, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	skipped := map[string]bool{}
+	for _, name := range skip {
+		if name != "" {
+			skipped[filepath.Clean(filepath.Join(dir, name))] = true
+		}
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || skipped[filepath.Clean(file)] {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		svc, err := findService(fset, file, src, typeName)
+		if err != nil {
+			return nil, err
+		}
+		if svc != nil {
+			return svc, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s not found in %s", typeName, dir)
+}
+
+// findService parses one file and returns the service for typeName, or nil
+// when the file does not declare it.
+func findService(fset *token.FileSet, filename string, src []byte, typeName string) (*service, error) {
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var iface *ast.InterfaceType
+	ast.Inspect(f, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == typeName {
+			iface, _ = spec.Type.(*ast.InterfaceType)
+			return false
+		}
+		return iface == nil
+	})
+	if iface == nil {
+		return nil, nil
+	}
+
+	svc := &service{Pkg: f.Name.Name, Name: typeName}
+	used := map[string]bool{}
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) != 1 {
+			return nil, fmt.Errorf("%s: %s may only contain methods", fset.Position(field.Pos()), typeName)
+		}
+		m, err := parseMethod(fset, field.Names[0].Name, fn, used)
+		if err != nil {
+			return nil, err
+		}
+		m.RPCName = nameDirective(field.Doc)
+		svc.Methods = append(svc.Methods, m)
+	}
+	if len(svc.Methods) == 0 {
+		return nil, fmt.Errorf("%s has no methods", typeName)
+	}
+
+	// keep the imports the parameter and result types refer to
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if used[name] && path != "context" {
+			svc.Imports = append(svc.Imports, importSpec(spec))
+		}
+	}
+	sort.Strings(svc.Imports)
+	return svc, nil
+}
+
+// parseMethod checks that fn is func(context.Context, P) (R, error). The
+// package names used in P and R are added to used.
+func parseMethod(fset *token.FileSet, name string, fn *ast.FuncType, used map[string]bool) (method, error) {
+	params, results := flatten(fn.Params), flatten(fn.Results)
+	if len(params) != 2 || exprString(fset, params[0]) != "context.Context" ||
+		len(results) != 2 || exprString(fset, results[1]) != "error" {
+		return method{}, fmt.Errorf("%s: method %s must have the form %s(context.Context, P) (R, error)",
+			fset.Position(fn.Pos()), name, name)
+	}
+
+	for _, expr := range []ast.Expr{params[1], results[0]} {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok {
+					used[pkg.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	return method{
+		GoName:     name,
+		ParamType:  exprString(fset, params[1]),
+		ResultType: exprString(fset, results[0]),
+	}, nil
+}
+
+// flatten lists one type per parameter, so "a, b int" yields two entries.
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var types []ast.Expr
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, field.Type)
+		}
+	}
+	return types
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, fset, expr)
+	return buf.String()
+}
+
+func importSpec(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name + " " + spec.Path.Value
+	}
+	return spec.Path.Value
+}
+
+// nameDirective returns the method name from a "//rpc:name x" doc comment line.
+func nameDirective(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for _, c := range doc.List {
+		if name, ok := strings.CutPrefix(c.Text, "//rpc:name "); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// setNames fills in the JSON-RPC names that no directive set: prefix, a dot
+// and the Go name with a lowercase first letter.
+func (s *service) setNames(prefix string) {
+	for i, m := range s.Methods {
+		if m.RPCName == "" {
+			r, size := utf8.DecodeRuneInString(m.GoName)
+			s.Methods[i].RPCName = prefix + "." + string(unicode.ToLower(r)) + m.GoName[size:]
+		}
+	}
+}
+
+func (s *service) clientSource(rpcclientImport string) ([]byte, error) {
+	if rpcclientImport == "" {
+		return nil, errors.New("missing import path of the rpcclient package")
+	}
+	return render(clientTemplate, s, map[string]string{"RPCClient": rpcclientImport})
+}
+
+func (s *service) serverSource(pkg, importPath string) ([]byte, error) {
+	if importPath == "" {
+		return nil, errors.New("missing import path of the interface's package")
+	}
+	return render(serverTemplate, s, map[string]string{"Package": pkg, "Import": importPath})
+}
+
+func render(tmpl *template.Template, s *service, extra map[string]string) ([]byte, error) {
+	data := map[string]any{"Service": s, "Extra": extra}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by rpcgen from {{.Service.Pkg}}.{{.Service.Name}}. DO NOT EDIT.
+
+package {{.Service.Pkg}}
+
+import (
+	"context"
+{{range .Service.Imports}}
+	{{.}}
+{{- end}}
+
+	rpcclient "{{.Extra.RPCClient}}"
+)
+
+// {{.Service.Name}}Client calls the {{.Service.Name}} methods on a JSON-RPC server.
+type {{.Service.Name}}Client struct {
+	client *rpcclient.Client
+}
+
+// New{{.Service.Name}}Client returns a {{.Service.Name}} that sends every call through client.
+func New{{.Service.Name}}Client(client *rpcclient.Client) *{{.Service.Name}}Client {
+	return &{{.Service.Name}}Client{client: client}
+}
+
+var _ {{.Service.Name}} = (*{{.Service.Name}}Client)(nil)
+{{range .Service.Methods}}
+// {{.GoName}} calls {{.RPCName}}.
+func (c *{{$.Service.Name}}Client) {{.GoName}}(ctx context.Context, params {{.ParamType}}) ({{.ResultType}}, error) {
+	var result {{.ResultType}}
+	err := c.client.Call(ctx, {{printf "%q" .RPCName}}, params, &result)
+	return result, err
+}
+{{end}}`))
+
+var serverTemplate = template.Must(template.New("server").Parse(`// Code generated by rpcgen from {{.Service.Pkg}}.{{.Service.Name}}. DO NOT EDIT.
+
+package {{.Extra.Package}}
+
+import {{.Service.Pkg}} "{{.Extra.Import}}"
+
+// register{{.Service.Name}} adds the methods of {{.Service.Pkg}}.{{.Service.Name}} to methodRegistry.
+func register{{.Service.Name}}(impl {{.Service.Pkg}}.{{.Service.Name}}) {
+{{- range .Service.Methods}}
+	Register({{printf "%q" .RPCName}}, impl.{{.GoName}})
+{{- end}}
+}
+`))
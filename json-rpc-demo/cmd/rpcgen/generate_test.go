@@ -0,0 +1,99 @@
+package main
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const testSource = `package api
+
+import (
+	"context"
+	"time"
+	"unused/pkg"
+)
+
+type Clock interface {
+	// Now returns the current time.
+	Now(ctx context.Context, params NowParams) (time.Time, error)
+	//rpc:name clock.sleepFor
+	Sleep(ctx context.Context, d time.Duration) (struct{}, error)
+	ListZones(ctx context.Context, _ struct{}) ([]string, error)
+}
+`
+
+func TestFindService(t *testing.T) {
+	svc, err := findService(token.NewFileSet(), "clock.go", []byte(testSource), "Clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.setNames("clock")
+
+	want := []method{
+		{GoName: "Now", RPCName: "clock.now", ParamType: "NowParams", ResultType: "time.Time"},
+		{GoName: "Sleep", RPCName: "clock.sleepFor", ParamType: "time.Duration", ResultType: "struct{}"},
+		{GoName: "ListZones", RPCName: "clock.listZones", ParamType: "struct{}", ResultType: "[]string"},
+	}
+	if len(svc.Methods) != len(want) {
+		t.Fatalf("methods = %+v", svc.Methods)
+	}
+	for i := range want {
+		if svc.Methods[i] != want[i] {
+			t.Errorf("method %d = %+v, want %+v", i, svc.Methods[i], want[i])
+		}
+	}
+	if len(svc.Imports) != 1 || svc.Imports[0] != `"time"` {
+		t.Errorf("imports = %q, want only time", svc.Imports)
+	}
+
+	client, err := svc.clientSource("example.com/rpc/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`"time"`,
+		`// Code generated by rpcgen from api.Clock. DO NOT EDIT.`,
+		`rpcclient "example.com/rpc/v2"`,
+		`func (c *ClockClient) Sleep(ctx context.Context, params time.Duration) (struct{}, error) {`,
+		`err := c.client.Call(ctx, "clock.sleepFor", params, &result)`,
+	} {
+		if !strings.Contains(string(client), line) {
+			t.Errorf("client source lacks %s:\n%s", line, client)
+		}
+	}
+
+	// the import path does not end in the package name, so it needs an alias
+	server, err := svc.serverSource("main", "example.com/api/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`// Code generated by rpcgen from api.Clock. DO NOT EDIT.`,
+		`import api "example.com/api/v2"`,
+		`func registerClock(impl api.Clock) {`,
+		`Register("clock.now", impl.Now)`,
+	} {
+		if !strings.Contains(string(server), line) {
+			t.Errorf("server source lacks %s:\n%s", line, server)
+		}
+	}
+}
+
+func TestFindServiceRejectsBadMethods(t *testing.T) {
+	tests := map[string]string{
+		"no context":   `Add(a, b int) (int, error)`,
+		"no error":     `Add(ctx context.Context, p int) int`,
+		"two params":   `Add(ctx context.Context, a, b int) (int, error)`,
+		"embedded":     `fmt.Stringer`,
+		"extra result": `Add(ctx context.Context, p int) (int, bool, error)`,
+	}
+	for name, decl := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := "package api\n\nimport (\n\t\"context\"\n\t\"fmt\"\n)\n\ntype Bad interface {\n\t" + decl + "\n}\n"
+			if _, err := findService(token.NewFileSet(), "bad.go", []byte(src), "Bad"); err == nil {
+				t.Fatal("findService accepted the method")
+			}
+		})
+	}
+}
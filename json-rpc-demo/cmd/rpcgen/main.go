@@ -0,0 +1,133 @@
+// Command rpcgen generates JSON-RPC glue from a Go interface. Every interface
+// method must have the form
+//
+//	Name(ctx context.Context, params P) (R, error)
+//
+// From it rpcgen writes a typed client stub next to the interface, and a
+// register function for the server that adds every method to methodRegistry
+// through Register. Both sides use the same P and R types.
+//
+// Use it from a go:generate directive in the file that declares the interface:
+//
+//	//go:generate go run ../cmd/rpcgen -type Math -prefix math -client math_client_gen.go -server ../server/math_rpc_gen.go
+//
+// Method names are the prefix and the Go method name with a lowercase first
+// letter, so Add becomes "math.add". A "//rpc:name other.name" line in the
+// method's doc comment overrides that.
+//
+// The client stub imports the rpcclient package of the module that contains
+// the interface; -rpcclient names a different one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the interface to generate code for (required)")
+	prefix := flag.String("prefix", "", "method name prefix (default: the interface name in lowercase)")
+	clientFile := flag.String("client", "", "output file for the client stub, in the interface's package")
+	serverFile := flag.String("server", "", "output file for the server registration glue")
+	serverPkg := flag.String("server-package", "main", "package name of the server glue")
+	importPath := flag.String("import", "", "import path of the interface's package (default: derived from go.mod)")
+	rpcclientImport := flag.String("rpcclient", "", "import path of the rpcclient package used by the client stub (default: derived from go.mod)")
+	dir := flag.String("dir", ".", "directory of the interface's package")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("rpcgen: ")
+	if *typeName == "" || (*clientFile == "" && *serverFile == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	svc, err := parseService(*dir, *typeName, *clientFile, *serverFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *prefix == "" {
+		*prefix = strings.ToLower(*typeName)
+	}
+	svc.setNames(*prefix)
+
+	if *clientFile != "" {
+		if *rpcclientImport == "" {
+			module, _, err := findModule(*dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			*rpcclientImport = module + "/rpcclient"
+		}
+		src, err := svc.clientSource(*rpcclientImport)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(*dir, *clientFile), src, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *serverFile != "" {
+		if *importPath == "" {
+			*importPath, err = packageImportPath(*dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		src, err := svc.serverSource(*serverPkg, *importPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(*dir, *serverFile), src, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// packageImportPath derives the import path of dir from the nearest go.mod.
+func packageImportPath(dir string) (string, error) {
+	module, root, err := findModule(dir)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return module, nil
+	}
+	return module + "/" + filepath.ToSlash(rel), nil
+}
+
+// findModule returns the module path and root directory of the nearest
+// go.mod at or above dir.
+func findModule(dir string) (module, root string, err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for root := abs; ; root = filepath.Dir(root) {
+		data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+					return strings.Trim(fields[1], `"`), root, nil
+				}
+			}
+			return "", "", fmt.Errorf("no module line in %s", filepath.Join(root, "go.mod"))
+		}
+		if filepath.Dir(root) == root {
+			return "", "", fmt.Errorf("no go.mod above %s; pass -import and -rpcclient", abs)
+		}
+	}
+}
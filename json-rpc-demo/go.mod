@@ -1,3 +1,7 @@
 module json-rpc-demo
 
-go 1.21
+go 1.24
+
+require go-streamable-http v0.0.0
+
+replace go-streamable-http => ../go-streamable-http
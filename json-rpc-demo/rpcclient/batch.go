@@ -0,0 +1,134 @@
+package rpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Batch collects calls and notifications and sends them in one request:
+//
+//	b := c.NewBatch()
+//	add := b.Call("math.add", []float64{1, 2}, &sum)
+//	b.Notify("events.publish", map[string]any{"topic": "t"})
+//	if err := b.Send(ctx); err != nil { ... } // the request as a whole failed
+//	if err := add.Err(); err != nil { ... }   // this call failed
+//
+// Responses are matched to calls by id, so their order does not matter.
+type Batch struct {
+	client   *Client
+	requests []request
+	calls    map[string]*BatchCall
+}
+
+// BatchCall is one call of a Batch. Its result is decoded when Send returns.
+type BatchCall struct {
+	method string
+	result any
+	err    error
+	done   bool
+}
+
+// Err returns the call's error after Send, wrapping *Error for errors the
+// server reported.
+func (bc *BatchCall) Err() error {
+	if !bc.done {
+		return fmt.Errorf("call %s: batch was not sent", bc.method)
+	}
+	return bc.err
+}
+
+// NewBatch starts an empty batch.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c, calls: map[string]*BatchCall{}}
+}
+
+// Call adds a call whose result is decoded into result (nil discards it).
+func (b *Batch) Call(method string, params, result any) *BatchCall {
+	id := b.client.newID()
+	b.requests = append(b.requests, request{JSONRPC: "2.0", Method: method, Params: params, ID: id})
+	call := &BatchCall{method: method, result: result}
+	b.calls[string(id)] = call
+	return call
+}
+
+// Notify adds a notification.
+func (b *Batch) Notify(method string, params any) {
+	b.requests = append(b.requests, request{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Send sends the batch and distributes the responses to the calls. It
+// returns an error when the batch as a whole failed; the calls then report
+// that error too. Errors of single calls are only available from their Err.
+func (b *Batch) Send(ctx context.Context) error {
+	if len(b.requests) == 0 {
+		return errors.New("batch is empty")
+	}
+
+	body, err := b.client.post(ctx, b.requests)
+	if err == nil {
+		err = b.distribute(body)
+	}
+	if err != nil {
+		err = fmt.Errorf("batch: %w", err)
+	}
+	for _, call := range b.calls {
+		if !call.done {
+			call.done = true
+			call.err = err
+			if call.err == nil {
+				call.err = fmt.Errorf("call %s: server sent no response", call.method)
+			}
+		}
+	}
+	return err
+}
+
+func (b *Batch) distribute(body []byte) error {
+	if body == nil {
+		if len(b.calls) > 0 {
+			return errors.New("server sent no response")
+		}
+		return nil
+	}
+
+	// a single error object means the server rejected the batch as a whole
+	if trimmed := strings.TrimSpace(string(body)); !strings.HasPrefix(trimmed, "[") {
+		var resp response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return errors.New("expected an array of responses")
+	}
+
+	var responses []response
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	var unmatched []*Error
+	for _, resp := range responses {
+		call, ok := b.calls[strings.TrimSpace(string(resp.ID))]
+		if !ok || call.done {
+			// errors about requests the server could not read have a null id
+			if resp.Error != nil {
+				unmatched = append(unmatched, resp.Error)
+			}
+			continue
+		}
+		call.done = true
+		if resp.Error != nil {
+			call.err = fmt.Errorf("call %s: %w", call.method, resp.Error)
+			continue
+		}
+		call.err = decodeResult(call.method, resp.Result, call.result)
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("%d response(s) without a matching call, first: %w", len(unmatched), unmatched[0])
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Package rpcclient is a typed JSON-RPC 2.0 client for the json-rpc-demo
+// server, or any server that speaks JSON-RPC over HTTP POST.
+//
+//	c := rpcclient.New("http://localhost:8080/rpc")
+//	var out struct{ Sum float64 `json:"sum"` }
+//	err := c.Call(ctx, "math.add", map[string]float64{"a": 2, "b": 3}, &out)
+//
+//	var rpcErr *rpcclient.Error
+//	if errors.As(err, &rpcErr) && rpcErr.Code == -32601 { ... }
+package rpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxRetries     = 2
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 2 * time.Second
+
+	// maxResponseSize bounds how much of a response body is read.
+	maxResponseSize = 16 << 20
+)
+
+// Client sends JSON-RPC requests over HTTP. It is safe for concurrent use.
+type Client struct {
+	// URL is the JSON-RPC endpoint, for example http://localhost:8080/rpc.
+	URL string
+	// HTTPClient is used for requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// Header is added to every request, for example an Authorization header.
+	Header http.Header
+
+	// MaxRetries is how often a request is repeated after a transport
+	// failure: a network error or a 502, 503 or 504 status. Zero means 2
+	// and a negative value disables retries. JSON-RPC errors are never
+	// retried. A request that failed on the way back may already have run
+	// on the server, so only use retries with methods that tolerate it.
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry; it doubles up to
+	// MaxBackoff, with jitter. Zero values mean 100ms and 2s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	nextID atomic.Uint64
+}
+
+// New returns a client for the endpoint at url with default settings.
+func New(url string) *Client {
+	return &Client{URL: url}
+}
+
+// Error is an error object returned by the server. Errors from Call and
+// Batch wrap it, so use errors.As to get at the code.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("json-rpc error %d: %s (data: %s)", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// StatusError reports an HTTP response that carried no JSON-RPC response.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  any             `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Call invokes method with params and decodes the result into result, which
+// may be nil to discard it. params may be nil, a struct or map (named
+// params), or a slice (positional params).
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	req := request{JSONRPC: "2.0", Method: method, Params: params, ID: c.newID()}
+	body, err := c.post(ctx, req)
+	if err != nil {
+		return fmt.Errorf("call %s: %w", method, err)
+	}
+	if body == nil {
+		return fmt.Errorf("call %s: server sent no response", method)
+	}
+
+	var resp response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("call %s: decode response: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("call %s: %w", method, resp.Error)
+	}
+	if !sameID(resp.ID, req.ID) {
+		return fmt.Errorf("call %s: response id %s does not match request id %s", method, resp.ID, req.ID)
+	}
+	return decodeResult(method, resp.Result, result)
+}
+
+// Notify sends method as a notification, so the server sends no result. An
+// error is only returned when the request could not be delivered, or when the
+// server answered with an error anyway, as the demo server does for failed
+// notifications outside strict mode.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	body, err := c.post(ctx, request{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("notify %s: %w", method, err)
+	}
+	if body == nil {
+		return nil
+	}
+	var resp response
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != nil {
+		return fmt.Errorf("notify %s: %w", method, resp.Error)
+	}
+	return nil
+}
+
+func (c *Client) newID() json.RawMessage {
+	return json.RawMessage(strconv.FormatUint(c.nextID.Add(1), 10))
+}
+
+// post sends payload and returns the response body, or nil when the server
+// answered without one. Transport failures are retried with backoff.
+func (c *Client) post(ctx context.Context, payload any) ([]byte, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	retries := c.MaxRetries
+	if retries == 0 {
+		retries = defaultMaxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		body, err := c.send(ctx, encoded)
+		if err == nil || !retryable(err) || attempt >= retries || ctx.Err() != nil {
+			return body, err
+		}
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// transportError marks failures that happened before a JSON-RPC response arrived.
+type transportError struct{ err error }
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+func retryable(err error) bool {
+	var te *transportError
+	return errors.As(err, &te)
+}
+
+func (c *Client) send(ctx context.Context, encoded []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for key, values := range c.Header {
+		httpReq.Header[key] = values
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, &transportError{fmt.Errorf("send request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, &transportError{&StatusError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	// the server sends JSON-RPC errors such as parse errors with a 400
+	if resp.StatusCode != http.StatusOK && !json.Valid(body) {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	return body, nil
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	initial, limit := c.InitialBackoff, c.MaxBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+	d := initial << attempt
+	if d > limit || d <= 0 {
+		d = limit
+	}
+	// jitter: wait somewhere between d/2 and d
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sameID(a, b json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(a), bytes.TrimSpace(b))
+}
+
+func decodeResult(method string, raw json.RawMessage, result any) error {
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("call %s: decode result: %w", method, err)
+	}
+	return nil
+}
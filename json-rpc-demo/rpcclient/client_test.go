@@ -0,0 +1,249 @@
+package rpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// answer builds the response a small test server gives to req: "add" sums
+// its positional params, "fail" returns an error, anything else is unknown.
+// Notifications get nil.
+func answer(req testRequest) map[string]any {
+	if req.ID == nil {
+		return nil
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "add":
+		var values []float64
+		json.Unmarshal(req.Params, &values)
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		resp["result"] = map[string]float64{"sum": sum}
+	case "fail":
+		resp["error"] = map[string]any{"code": -32000, "message": "failed", "data": map[string]string{"why": "test"}}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	return resp
+}
+
+// rpcServer answers single requests and batches; batch responses come back
+// in reverse order to show that matching is done by id.
+func rpcServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var out any
+		if body[0] == '[' {
+			var reqs []testRequest
+			json.Unmarshal(body, &reqs)
+			var resps []map[string]any
+			for i := len(reqs) - 1; i >= 0; i-- {
+				if resp := answer(reqs[i]); resp != nil {
+					resps = append(resps, resp)
+				}
+			}
+			if len(resps) > 0 {
+				out = resps
+			}
+		} else {
+			var req testRequest
+			json.Unmarshal(body, &req)
+			if resp := answer(req); resp != nil {
+				out = resp
+			}
+		}
+		if out == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type sumResult struct {
+	Sum float64 `json:"sum"`
+}
+
+func TestCall(t *testing.T) {
+	c := New(rpcServer(t).URL)
+	for i := 0; i < 2; i++ {
+		var out sumResult
+		if err := c.Call(context.Background(), "add", []float64{2, 3}, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Sum != 5 {
+			t.Fatalf("sum = %v, want 5", out.Sum)
+		}
+	}
+}
+
+func TestCallError(t *testing.T) {
+	c := New(rpcServer(t).URL)
+	err := c.Call(context.Background(), "fail", nil, nil)
+
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("Call = %v, want a wrapped *Error", err)
+	}
+	if rpcErr.Code != -32000 || string(rpcErr.Data) != `{"why":"test"}` {
+		t.Fatalf("error = %+v", rpcErr)
+	}
+}
+
+func TestCallMismatchedID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"jsonrpc":"2.0","result":1,"id":12345}`)
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL).Call(context.Background(), "add", nil, nil); err == nil {
+		t.Fatal("Call succeeded with a response for another id")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	c := New(rpcServer(t).URL)
+	if err := c.Notify(context.Background(), "add", []float64{1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	c := New(rpcServer(t).URL)
+	b := c.NewBatch()
+	var first, second sumResult
+	add1 := b.Call("add", []float64{1, 2}, &first)
+	b.Notify("add", []float64{100})
+	add2 := b.Call("add", []float64{3, 4}, &second)
+	missing := b.Call("nope", nil, nil)
+
+	if err := b.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if add1.Err() != nil || add2.Err() != nil || first.Sum != 3 || second.Sum != 7 {
+		t.Fatalf("results = %v %v, errors = %v %v", first, second, add1.Err(), add2.Err())
+	}
+	var rpcErr *Error
+	if !errors.As(missing.Err(), &rpcErr) || rpcErr.Code != -32601 {
+		t.Fatalf("missing method error = %v", missing.Err())
+	}
+}
+
+func TestBatchRejectedAsWhole(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"invalid JSON batch"},"id":null}`)
+	}))
+	defer srv.Close()
+
+	b := New(srv.URL).NewBatch()
+	call := b.Call("add", nil, nil)
+	err := b.Send(context.Background())
+
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32700 {
+		t.Fatalf("Send = %v, want the -32700 error", err)
+	}
+	if !errors.As(call.Err(), &rpcErr) {
+		t.Fatalf("call error = %v, want the batch error", call.Err())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail answers the first attempts; nil lets the request through
+		fail         func(w http.ResponseWriter)
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{
+			name: "connection dropped",
+			fail: func(w http.ResponseWriter) {
+				conn, _, _ := http.NewResponseController(w).Hijack()
+				conn.Close()
+			},
+			wantAttempts: 3,
+		},
+		{
+			name:         "service unavailable",
+			fail:         func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+			wantAttempts: 3,
+		},
+		{
+			name:         "internal server error is not retried",
+			fail:         func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) },
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name: "JSON-RPC errors are not retried",
+			fail: func(w http.ResponseWriter) {
+				io.WriteString(w, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"busy"},"id":1}`)
+			},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) < 3 {
+					tt.fail(w)
+					return
+				}
+				io.WriteString(w, `{"jsonrpc":"2.0","result":{"sum":1},"id":1}`)
+			}))
+			defer srv.Close()
+
+			c := &Client{URL: srv.URL, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+			err := c.Call(context.Background(), "add", nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Call = %v, want error: %v", err, tt.wantErr)
+			}
+			if n := attempts.Load(); n != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetriesDisabled(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, MaxRetries: -1}
+	err := c.Call(context.Background(), "add", nil, nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Call = %v, want a 503 status error", err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("attempts = %d, want 1", n)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Identities that do not come from credentials.
+const (
+	anonymousIdentity = "anonymous" // no credentials were sent
+	localIdentity     = "local"     // stdio and Unix socket clients
+)
+
+// hmacMaxSkew is how far the timestamp of a signed request may be off.
+const hmacMaxSkew = 5 * time.Minute
+
+// hmacMaxNonce is the longest X-Signature-Nonce accepted.
+const hmacMaxNonce = 64
+
+// metricsPolicyName stands in for a method name when the policy is checked
+// for GET /metrics. GET /openrpc.json uses the entry of rpc.discover, which
+// returns the same document.
+const metricsPolicyName = "server.metrics"
+
+// authConfig is the format of the -auth-config file.
+type authConfig struct {
+	Tokens   []tokenConfig       `json:"tokens"`
+	HMACKeys []hmacKeyConfig     `json:"hmac_keys"`
+	Policy   map[string][]string `json:"policy"` // identity -> method name patterns
+}
+
+type tokenConfig struct {
+	Identity string `json:"identity"`
+	Token    string `json:"token"`
+}
+
+type hmacKeyConfig struct {
+	Identity string `json:"identity"`
+	Secret   string `json:"secret"`
+}
+
+// authSettings holds the loaded configuration. A nil *authSettings means
+// authentication is disabled and every call is allowed.
+type authSettings struct {
+	authenticators []authenticator
+	policy         map[string][]string
+}
+
+var authn *authSettings
+
+func loadAuthConfig(file string) (*authSettings, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cfg authConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	for identity, patterns := range cfg.Policy {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("policy for %s: bad pattern %q", identity, pattern)
+			}
+		}
+	}
+	bearer := bearerAuth{}
+	for _, t := range cfg.Tokens {
+		if t.Identity == "" || t.Token == "" {
+			return nil, errors.New("every token needs an identity and a token")
+		}
+		bearer = append(bearer, t)
+	}
+	signed := hmacAuth{keys: map[string][]byte{}, nonces: &nonceCache{seen: map[string]time.Time{}}}
+	for _, k := range cfg.HMACKeys {
+		if k.Identity == "" || k.Secret == "" {
+			return nil, errors.New("every HMAC key needs an identity and a secret")
+		}
+		signed.keys[k.Identity] = []byte(k.Secret)
+	}
+
+	return &authSettings{
+		authenticators: []authenticator{bearer, signed},
+		policy:         cfg.Policy,
+	}, nil
+}
+
+// authenticator checks one kind of credentials. ok is false when the request
+// carries none of them; err is set when they are present but invalid.
+type authenticator interface {
+	authenticate(r *http.Request, body []byte) (name string, ok bool, err error)
+}
+
+// authenticate identifies the caller of an HTTP request, including WebSocket
+// upgrades, with the first authenticator that finds credentials. Why
+// credentials were rejected is logged here and never sent to the client.
+func (a *authSettings) authenticate(r *http.Request, body []byte) identity {
+	if a == nil {
+		return identity{name: anonymousIdentity}
+	}
+	for _, auth := range a.authenticators {
+		name, ok, err := auth.authenticate(r, body)
+		if err != nil {
+			slog.Warn("rejected credentials", "remote_addr", r.RemoteAddr, "path", r.URL.Path, "reason", err)
+			return identity{name: anonymousIdentity, err: err}
+		}
+		if ok {
+			return identity{name: name}
+		}
+	}
+	return identity{name: anonymousIdentity}
+}
+
+// allows reports whether the policy lets name call method. Patterns use
+// path.Match syntax, so "math.*" covers every math method and "*" everything.
+func (a *authSettings) allows(name, method string) bool {
+	if a == nil {
+		return true
+	}
+	for _, pattern := range a.policy[name] {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerAuth accepts "Authorization: Bearer <token>".
+type bearerAuth []tokenConfig
+
+func (b bearerAuth) authenticate(r *http.Request, _ []byte) (string, bool, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false, nil
+	}
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false, nil
+	}
+	// compare against every token so the timing does not reveal a partial match
+	name := ""
+	for _, t := range b {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(strings.TrimSpace(token))) == 1 {
+			name = t.Identity
+		}
+	}
+	if name == "" {
+		return "", false, errors.New("unknown bearer token")
+	}
+	return name, true, nil
+}
+
+// hmacAuth accepts requests signed with a shared secret per identity:
+//
+//	X-Signature-Identity: <identity>
+//	X-Signature-Timestamp: <unix seconds>
+//	X-Signature-Nonce: <up to 64 letters, digits, '-' or '_', new for every request>
+//	X-Signature: hex(HMAC-SHA256(secret, timestamp + "." + nonce + "." + body))
+//
+// Each nonce is accepted once per identity, so a captured request cannot be
+// sent again while its timestamp is still within hmacMaxSkew; after that the
+// timestamp check rejects it.
+type hmacAuth struct {
+	keys   map[string][]byte
+	nonces *nonceCache
+}
+
+func (h hmacAuth) authenticate(r *http.Request, body []byte) (string, bool, error) {
+	name := r.Header.Get("X-Signature-Identity")
+	if name == "" {
+		return "", false, nil
+	}
+	secret, ok := h.keys[name]
+	if !ok {
+		return "", false, fmt.Errorf("no HMAC key for %s", name)
+	}
+
+	ts := r.Header.Get("X-Signature-Timestamp")
+	seconds, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", false, errors.New("invalid X-Signature-Timestamp")
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := time.Since(signedAt); skew > hmacMaxSkew || skew < -hmacMaxSkew {
+		return "", false, errors.New("signature timestamp is too far off")
+	}
+	nonce := r.Header.Get("X-Signature-Nonce")
+	if !validNonce(nonce) {
+		return "", false, errors.New("missing or invalid X-Signature-Nonce")
+	}
+
+	got, err := hex.DecodeString(r.Header.Get("X-Signature"))
+	if err != nil {
+		return "", false, errors.New("invalid X-Signature")
+	}
+	if !hmac.Equal(got, signRequest(secret, ts, nonce, body)) {
+		return "", false, errors.New("signature mismatch")
+	}
+	// only a correctly signed request may use up its nonce
+	if !h.nonces.add(name+" "+nonce, signedAt.Add(hmacMaxSkew)) {
+		return "", false, errors.New("nonce was already used")
+	}
+	return name, true, nil
+}
+
+func signRequest(secret []byte, timestamp, nonce string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// validNonce limits nonces to characters that cannot be confused with the
+// separators of the signed string.
+func validNonce(nonce string) bool {
+	if nonce == "" || len(nonce) > hmacMaxNonce {
+		return false
+	}
+	for _, c := range nonce {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// nonceCache remembers used nonces until the timestamps they were signed
+// with expire.
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time // identity and nonce -> expiry
+	pruned time.Time
+}
+
+// add records key and reports false if it is already recorded and not yet expired.
+func (c *nonceCache) add(key string, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.pruned) > time.Minute {
+		for k, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, k)
+			}
+		}
+		c.pruned = now
+	}
+	if exp, ok := c.seen[key]; ok && !now.After(exp) {
+		return false
+	}
+	c.seen[key] = expires
+	return true
+}
+
+// identity is the authenticated caller. Handlers get it with identityFrom.
+type identity struct {
+	name string
+	// err is set when the request carried credentials that were rejected;
+	// every call of such a request fails with codeUnauthenticated.
+	err error
+}
+
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, id identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func identityFrom(ctx context.Context) identity {
+	id, ok := ctx.Value(identityKey{}).(identity)
+	if !ok {
+		return identity{name: anonymousIdentity}
+	}
+	return id
+}
+
+// authorize checks every call against the policy. It answers with JSON-RPC
+// errors rather than HTTP 401/403, so each entry of a batch fails on its own.
+func authorize(next methodFunc) methodFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+		if authn == nil {
+			return next(ctx, params)
+		}
+		id := identityFrom(ctx)
+		if id.err != nil {
+			return nil, &rpcError{Code: codeUnauthenticated, Message: "unauthorized"}
+		}
+		method := callFrom(ctx).method
+		if !authn.allows(id.name, method) {
+			return nil, &rpcError{Code: codeForbidden, Message: "method not allowed", Data: map[string]string{"identity": id.name, "method": method}}
+		}
+		return next(ctx, params)
+	}
+}
+
+// requirePolicy guards a plain HTTP endpoint with the same credentials and
+// policy as method calls, checking name where a call would check its method.
+func requirePolicy(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authn != nil {
+			id := authn.authenticate(r, nil)
+			if id.err != nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !authn.allows(id.name, name) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+type whoamiResult struct {
+	Identity string `json:"identity"`
+}
+
+// whoami reports the identity the server sees for the caller.
+func whoami(ctx context.Context, _ struct{}) (whoamiResult, error) {
+	return whoamiResult{Identity: identityFrom(ctx).name}, nil
+}
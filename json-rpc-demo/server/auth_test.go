@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAuthConfig is loaded by useAuth.
+const testAuthConfig = `{
+	"tokens": [
+		{"identity": "alice", "token": "alice-token"},
+		{"identity": "bob", "token": "bob-token"}
+	],
+	"hmac_keys": [{"identity": "ci", "secret": "ci-secret"}],
+	"policy": {
+		"alice": ["*"],
+		"bob": ["math.*", "auth.whoami"],
+		"ci": ["math.add", "server.metrics"],
+		"anonymous": ["rpc.discover"]
+	}
+}`
+
+// useAuth enables authentication with config for the rest of the test.
+func useAuth(t *testing.T, config string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "auth.json")
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := loadAuthConfig(file)
+	if err != nil {
+		t.Fatalf("loadAuthConfig: %v", err)
+	}
+	orig := authn
+	authn = settings
+	t.Cleanup(func() { authn = orig })
+}
+
+func TestHTTPEndpointPolicy(t *testing.T) {
+	useAuth(t, testAuthConfig)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openrpc.json", requirePolicy("rpc.discover", openRPCHandler))
+	mux.HandleFunc("/metrics", requirePolicy(metricsPolicyName, metricsHandler))
+
+	tests := []struct {
+		path  string
+		token string // "" sends no Authorization header
+		want  int
+	}{
+		{"/openrpc.json", "", http.StatusOK},
+		{"/openrpc.json", "bob-token", http.StatusForbidden},
+		{"/openrpc.json", "wrong-token", http.StatusUnauthorized},
+		{"/metrics", "", http.StatusForbidden},
+		{"/metrics", "bob-token", http.StatusForbidden},
+		{"/metrics", "alice-token", http.StatusOK},
+		{"/metrics", "wrong-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("GET %s with token %q = %d, want %d", tt.path, tt.token, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRejectedCredentialsAreGeneric(t *testing.T) {
+	useAuth(t, testAuthConfig)
+
+	// neither the reason nor the identity tried leaks into the response
+	for _, header := range []http.Header{
+		{"Authorization": {"Bearer wrong-token"}},
+		{"X-Signature-Identity": {"ci"}, "X-Signature-Timestamp": {"0"}, "X-Signature": {"00"}},
+		{"X-Signature-Identity": {"nobody"}},
+	} {
+		body := `{"jsonrpc": "2.0", "method": "rpc.discover", "id": 1}`
+		r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		r.Header = header
+		w := httptest.NewRecorder()
+		rpcHandler(w, r)
+
+		want := `{"jsonrpc":"2.0","error":{"code":-32004,"message":"unauthorized"},"id":1}`
+		if got := strings.TrimSpace(w.Body.String()); got != want {
+			t.Errorf("headers %v: response = %s, want %s", header, got, want)
+		}
+	}
+}
+
+// signedRequest returns a POST of body signed as identity with secret.
+func signedRequest(identity, secret string, at time.Time, nonce, body string) *http.Request {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	r.Header.Set("X-Signature-Identity", identity)
+	r.Header.Set("X-Signature-Timestamp", ts)
+	r.Header.Set("X-Signature-Nonce", nonce)
+	r.Header.Set("X-Signature", hex.EncodeToString(signRequest([]byte(secret), ts, nonce, []byte(body))))
+	return r
+}
+
+func TestSignedRequestReplay(t *testing.T) {
+	useAuth(t, testAuthConfig)
+	body := []byte(`{"jsonrpc": "2.0", "method": "math.add", "params": [1, 2], "id": 1}`)
+	now := time.Now()
+
+	first := signedRequest("ci", "ci-secret", now, "n1", string(body))
+	if id := authn.authenticate(first, body); id.name != "ci" {
+		t.Fatalf("first request authenticated as %+v, want ci", id)
+	}
+	// the identical request, and the same nonce with a fresh timestamp, are replays
+	for _, r := range []*http.Request{
+		signedRequest("ci", "ci-secret", now, "n1", string(body)),
+		signedRequest("ci", "ci-secret", now.Add(time.Second), "n1", string(body)),
+	} {
+		if id := authn.authenticate(r, body); id.err == nil {
+			t.Errorf("replayed nonce authenticated as %+v", id)
+		}
+	}
+	// a new nonce is accepted
+	if id := authn.authenticate(signedRequest("ci", "ci-secret", now, "n2", string(body)), body); id.name != "ci" {
+		t.Errorf("new nonce authenticated as %+v, want ci", id)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	useAuth(t, testAuthConfig)
+	body := `{"jsonrpc": "2.0", "method": "math.add", "params": [1, 2], "id": 1}`
+	now := time.Now()
+	bearer := func(header string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		r.Header.Set("Authorization", header)
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		want     string
+		rejected bool
+	}{
+		{name: "no credentials", req: httptest.NewRequest(http.MethodPost, "/rpc", nil), want: anonymousIdentity},
+		{name: "bearer", req: bearer("Bearer alice-token"), want: "alice"},
+		{name: "bearer scheme is case-insensitive", req: bearer("bearer bob-token"), want: "bob"},
+		{name: "unknown bearer token", req: bearer("Bearer carol-token"), rejected: true},
+		{name: "token prefix", req: bearer("Bearer alice"), rejected: true},
+		{name: "other scheme is not credentials", req: bearer("Basic YWxpY2U6eA=="), want: anonymousIdentity},
+		{name: "signed", req: signedRequest("ci", "ci-secret", now, "a", body), want: "ci"},
+		{name: "wrong secret", req: signedRequest("ci", "other-secret", now, "b", body), rejected: true},
+		{name: "unknown signer", req: signedRequest("nobody", "ci-secret", now, "c", body), rejected: true},
+		{name: "signed too long ago", req: signedRequest("ci", "ci-secret", now.Add(-hmacMaxSkew-time.Minute), "d", body), rejected: true},
+		{name: "signed in the future", req: signedRequest("ci", "ci-secret", now.Add(hmacMaxSkew+time.Minute), "e", body), rejected: true},
+		{name: "missing nonce", req: signedRequest("ci", "ci-secret", now, "", body), rejected: true},
+		{name: "nonce with a separator", req: signedRequest("ci", "ci-secret", now, "f.g", body), rejected: true},
+		{name: "nonce too long", req: signedRequest("ci", "ci-secret", now, strings.Repeat("h", hmacMaxNonce+1), body), rejected: true},
+		{
+			// bearer credentials are checked first and win over a signature
+			name: "bearer before signature",
+			req: func() *http.Request {
+				r := signedRequest("ci", "ci-secret", now, "i", body)
+				r.Header.Set("Authorization", "Bearer bob-token")
+				return r
+			}(),
+			want: "bob",
+		},
+		{
+			name: "rejected bearer is not rescued by a signature",
+			req: func() *http.Request {
+				r := signedRequest("ci", "ci-secret", now, "j", body)
+				r.Header.Set("Authorization", "Bearer wrong-token")
+				return r
+			}(),
+			rejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := authn.authenticate(tt.req, []byte(body))
+			if tt.rejected {
+				if id.err == nil || id.name != anonymousIdentity {
+					t.Errorf("authenticate = %+v, want rejected", id)
+				}
+				return
+			}
+			if id.err != nil || id.name != tt.want {
+				t.Errorf("authenticate = %+v, want %s", id, tt.want)
+			}
+		})
+	}
+
+	t.Run("tampered body", func(t *testing.T) {
+		r := signedRequest("ci", "ci-secret", now, "k", body)
+		if id := authn.authenticate(r, []byte(strings.Replace(body, "[1, 2]", "[1, 3]", 1))); id.err == nil {
+			t.Errorf("authenticate = %+v, want rejected", id)
+		}
+	})
+}
+
+func TestPolicyAllows(t *testing.T) {
+	useAuth(t, testAuthConfig)
+
+	tests := []struct {
+		identity string
+		method   string
+		want     bool
+	}{
+		{"alice", "math.add", true},
+		{"alice", "debug.panic", true},
+		{"bob", "math.add", true},
+		{"bob", "math.concat", true},
+		{"bob", "auth.whoami", true},
+		{"bob", "rpc.discover", false},
+		{"bob", "math", false},              // "math.*" needs the dot
+		{"bob", "mathematics.add", false},   // patterns match whole names
+		{"bob", "auth.whoami.extra", false}, // exact entries match only themselves
+		{"ci", "math.add", true},
+		{"ci", "math.concat", false},
+		{"anonymous", "rpc.discover", true},
+		{"anonymous", "math.add", false},
+		{"carol", "rpc.discover", false}, // identities without an entry may call nothing
+		{"local", "math.add", false},
+	}
+	for _, tt := range tests {
+		if got := authn.allows(tt.identity, tt.method); got != tt.want {
+			t.Errorf("allows(%s, %s) = %v, want %v", tt.identity, tt.method, got, tt.want)
+		}
+	}
+
+	var disabled *authSettings
+	if !disabled.allows("carol", "debug.panic") {
+		t.Error("disabled auth denied a call")
+	}
+}
+
+func TestLoadAuthConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{name: "valid", config: testAuthConfig},
+		{name: "bad pattern", config: `{"policy": {"bob": ["math.*", "math.[a"]}}`, err: `policy for bob: bad pattern "math.[a"`},
+		{name: "token without identity", config: `{"tokens": [{"token": "t"}]}`, err: "every token needs an identity and a token"},
+		{name: "key without secret", config: `{"hmac_keys": [{"identity": "ci"}]}`, err: "every HMAC key needs an identity and a secret"},
+		{name: "not JSON", config: `{"tokens": `, err: "parse "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "auth.json")
+			if err := os.WriteFile(file, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadAuthConfig(file)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("loadAuthConfig = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("loadAuthConfig = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
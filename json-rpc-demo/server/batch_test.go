@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type blockParams struct {
+	N int `json:"n"`
+}
+
+// forEachMode runs fn once with the default batch handling and once in strict
+// mode, which has its own batch loop.
+func forEachMode(t *testing.T, fn func(t *testing.T)) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			orig := strictMode
+			strictMode = strict
+			t.Cleanup(func() { strictMode = orig })
+			fn(t)
+		})
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	forEachMode(t, func(t *testing.T) {
+		useMethods(t)
+		origParallelism := batchParallelism
+		batchParallelism = 2
+		t.Cleanup(func() { batchParallelism = origParallelism })
+
+		// every call blocks until the test releases it, so the test decides the
+		// order in which entries finish
+		const entries = 4
+		started := make(chan int, entries)
+		release := make([]chan struct{}, entries+1)
+		for i := range release {
+			release[i] = make(chan struct{})
+		}
+		var inFlight, maxInFlight atomic.Int32
+		Register("block", func(ctx context.Context, p blockParams) (int, error) {
+			n := inFlight.Add(1)
+			for {
+				peak := maxInFlight.Load()
+				if n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+					break
+				}
+			}
+			started <- p.N
+			<-release[p.N]
+			inFlight.Add(-1)
+			return p.N * 10, nil
+		})
+
+		var batch []string
+		for n := 1; n <= entries; n++ {
+			batch = append(batch, fmt.Sprintf(`{"jsonrpc": "2.0", "method": "block", "params": {"n": %d}, "id": %d}`, n, n))
+		}
+		done := make(chan any, 1)
+		go func() { done <- call(t, "["+strings.Join(batch, ",")+"]") }()
+
+		// release the most recently started call each time, so entries finish
+		// in a different order than they were sent
+		running := []int{}
+		for finished := 0; finished < entries; finished++ {
+			for len(running) < batchParallelism && finished+len(running) < entries {
+				select {
+				case n := <-started:
+					running = append(running, n)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("only %d calls running, want %d", len(running), batchParallelism)
+				}
+			}
+			select {
+			case n := <-started:
+				t.Fatalf("call %d started while %v were running", n, running)
+			case <-time.After(20 * time.Millisecond):
+			}
+			last := running[len(running)-1]
+			running = running[:len(running)-1]
+			close(release[last])
+		}
+
+		var got any
+		select {
+		case got = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("batch never finished")
+		}
+		want := normalize(t, []byte(`[
+			{"jsonrpc": "2.0", "result": 10, "id": 1},
+			{"jsonrpc": "2.0", "result": 20, "id": 2},
+			{"jsonrpc": "2.0", "result": 30, "id": 3},
+			{"jsonrpc": "2.0", "result": 40, "id": 4}
+		]`))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("responses = %v, want them in request order %v", got, want)
+		}
+		if peak := maxInFlight.Load(); peak != int32(batchParallelism) {
+			t.Errorf("at most %d calls ran at once, want %d", peak, batchParallelism)
+		}
+	})
+}
+
+func TestBatchTimeout(t *testing.T) {
+	forEachMode(t, func(t *testing.T) {
+		useMethods(t)
+		Register("echo", func(_ context.Context, p blockParams) (int, error) {
+			return p.N, nil
+		})
+		Register("slow", func(ctx context.Context, _ struct{}) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		methodTimeouts["slow"] = 20 * time.Millisecond
+
+		// the slow entry times out in its own slot; its neighbours and the
+		// notification are unaffected
+		got := call(t, `[
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 1}, "id": 1},
+			{"jsonrpc": "2.0", "method": "slow", "id": 2},
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 3}},
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 4}, "id": 4}
+		]`)
+		want := normalize(t, []byte(`[
+			{"jsonrpc": "2.0", "result": 1, "id": 1},
+			{"jsonrpc": "2.0", "error": {"code": -32001}, "id": 2},
+			{"jsonrpc": "2.0", "result": 4, "id": 4}
+		]`))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("responses = %v\nwant %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The cases below are the examples from section 7 of the JSON-RPC 2.0
+// specification (https://www.jsonrpc.org/specification#examples), followed by
+// the edge cases strict mode exists for. They run against rpcHandler with the
+// methods the examples use.
+
+type subtractParams struct {
+	Minuend    float64 `json:"minuend"`
+	Subtrahend float64 `json:"subtrahend"`
+}
+
+func useSpecMethods(t *testing.T) {
+	t.Helper()
+	origRegistry, origStrict := methodRegistry, strictMode
+	methodRegistry, strictMode = map[string]methodFunc{}, true
+	t.Cleanup(func() { methodRegistry, strictMode = origRegistry, origStrict })
+
+	Register("subtract", func(_ context.Context, p subtractParams) (float64, error) {
+		return p.Minuend - p.Subtrahend, nil
+	})
+	Register("sum", func(_ context.Context, values []float64) (float64, error) {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum, nil
+	})
+	Register("get_data", func(context.Context, struct{}) ([]any, error) {
+		return []any{"hello", 5}, nil
+	})
+	Register("fail", func(context.Context, struct{}) (any, error) {
+		return nil, errors.New("always fails")
+	})
+	noop := func(context.Context, json.RawMessage) (any, error) { return nil, nil }
+	Register("update", noop)
+	Register("notify_hello", noop)
+	Register("notify_sum", noop)
+}
+
+func TestSpecConformance(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		// response is the expected body, "" for no response at all. Error
+		// messages and data are not compared, the codes are.
+		response string
+	}{
+		{
+			name:     "positional params",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+			response: `{"jsonrpc": "2.0", "result": 19, "id": 1}`,
+		},
+		{
+			name:     "positional params reversed",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": [23, 42], "id": 2}`,
+			response: `{"jsonrpc": "2.0", "result": -19, "id": 2}`,
+		},
+		{
+			name:     "named params",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend": 23, "minuend": 42}, "id": 3}`,
+			response: `{"jsonrpc": "2.0", "result": 19, "id": 3}`,
+		},
+		{
+			name:     "named params reordered",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": {"minuend": 42, "subtrahend": 23}, "id": 4}`,
+			response: `{"jsonrpc": "2.0", "result": 19, "id": 4}`,
+		},
+		{
+			name:    "notification",
+			request: `{"jsonrpc": "2.0", "method": "update", "params": [1,2,3,4,5]}`,
+		},
+		{
+			name:    "notification of a missing method",
+			request: `{"jsonrpc": "2.0", "method": "foobar"}`,
+		},
+		{
+			name:     "missing method",
+			request:  `{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32601}, "id": "1"}`,
+		},
+		{
+			name:     "invalid JSON",
+			request:  `{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32700}, "id": null}`,
+		},
+		{
+			name:     "invalid request object",
+			request:  `{"jsonrpc": "2.0", "method": 1, "params": "bar"}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`,
+		},
+		{
+			name: "batch with invalid JSON",
+			request: `[
+				{"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+				{"jsonrpc": "2.0", "method"
+			]`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32700}, "id": null}`,
+		},
+		{
+			name:     "empty batch",
+			request:  `[]`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`,
+		},
+		{
+			name:     "invalid batch with one element",
+			request:  `[1]`,
+			response: `[{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}]`,
+		},
+		{
+			name:    "invalid batch",
+			request: `[1,2,3]`,
+			response: `[
+				{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null},
+				{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null},
+				{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}
+			]`,
+		},
+		{
+			name: "batch",
+			request: `[
+				{"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+				{"jsonrpc": "2.0", "method": "notify_hello", "params": [7]},
+				{"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": "2"},
+				{"foo": "boo"},
+				{"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": "5"},
+				{"jsonrpc": "2.0", "method": "get_data", "id": "9"}
+			]`,
+			response: `[
+				{"jsonrpc": "2.0", "result": 7, "id": "1"},
+				{"jsonrpc": "2.0", "result": 19, "id": "2"},
+				{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null},
+				{"jsonrpc": "2.0", "error": {"code": -32601}, "id": "5"},
+				{"jsonrpc": "2.0", "result": ["hello", 5], "id": "9"}
+			]`,
+		},
+		{
+			name: "batch of notifications",
+			request: `[
+				{"jsonrpc": "2.0", "method": "notify_sum", "params": [1,2,4]},
+				{"jsonrpc": "2.0", "method": "notify_hello", "params": [7]}
+			]`,
+		},
+
+		// edge cases beyond the examples
+		{
+			name:     "fractional-looking id is echoed verbatim",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1.0}`,
+			response: `{"jsonrpc": "2.0", "result": 19, "id": 1.0}`,
+		},
+		{
+			name:     "null id is a call",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": null}`,
+			response: `{"jsonrpc": "2.0", "result": 19, "id": null}`,
+		},
+		{
+			name:     "null id gets errors too",
+			request:  `{"jsonrpc": "2.0", "method": "foobar", "id": null}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32601}, "id": null}`,
+		},
+		{
+			name:    "failing notification",
+			request: `{"jsonrpc": "2.0", "method": "fail"}`,
+		},
+		{
+			name:    "notification with invalid params",
+			request: `{"jsonrpc": "2.0", "method": "subtract", "params": ["a", "b"]}`,
+		},
+		{
+			name:    "batch with failing notifications",
+			request: `[{"jsonrpc": "2.0", "method": "fail"}, {"jsonrpc": "2.0", "method": "foobar", "params": [1]}]`,
+		},
+		{
+			name:     "invalid params",
+			request:  `{"jsonrpc": "2.0", "method": "subtract", "params": ["a", "b"], "id": 7}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32602}, "id": 7}`,
+		},
+		{
+			name:     "server error",
+			request:  `{"jsonrpc": "2.0", "method": "fail", "id": 8}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32000}, "id": 8}`,
+		},
+		{
+			name:     "null result is sent",
+			request:  `{"jsonrpc": "2.0", "method": "update", "id": 9}`,
+			response: `{"jsonrpc": "2.0", "result": null, "id": 9}`,
+		},
+		{
+			name:     "wrong version without id",
+			request:  `{"jsonrpc": "1.0", "method": "update"}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`,
+		},
+		{
+			name:     "wrong version keeps the id",
+			request:  `{"jsonrpc": "1.0", "method": "update", "id": 10}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": 10}`,
+		},
+		{
+			name:     "object id",
+			request:  `{"jsonrpc": "2.0", "method": "update", "id": {"a": 1}}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`,
+		},
+		{
+			name:     "scalar params",
+			request:  `{"jsonrpc": "2.0", "method": "update", "params": 3, "id": 11}`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": 11}`,
+		},
+		{
+			name:     "scalar message",
+			request:  `"hello"`,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600}, "id": null}`,
+		},
+	}
+
+	useSpecMethods(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rpcHandler(rec, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.request)))
+
+			if tt.response == "" {
+				if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+					t.Fatalf("got %d %s, want no response", rec.Code, rec.Body)
+				}
+				return
+			}
+			got, want := normalize(t, rec.Body.Bytes()), normalize(t, []byte(tt.response))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("response = %s\nwant %s", rec.Body, tt.response)
+			}
+		})
+	}
+}
+
+// normalize decodes a response body with numbers kept as written and drops
+// the parts of error objects that the specification leaves to the server.
+func normalize(t *testing.T, body []byte) any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+
+	strip := func(resp any) {
+		obj, ok := resp.(map[string]any)
+		if !ok {
+			return
+		}
+		if e, ok := obj["error"].(map[string]any); ok {
+			delete(e, "message")
+			delete(e, "data")
+		}
+	}
+	if list, ok := v.([]any); ok {
+		for _, resp := range list {
+			strip(resp)
+		}
+	} else {
+		strip(v)
+	}
+	return v
+}
+
+func TestStrictHandleMessageNotifications(t *testing.T) {
+	// the WebSocket, stdio and Unix socket transports call handleMessage
+	// directly; a batch of notifications must leave them nothing to send
+	useSpecMethods(t)
+	resp, ok := handleMessage(context.Background(), []byte(`[{"jsonrpc": "2.0", "method": "notify_hello", "params": [7]}]`))
+	if resp != nil || !ok {
+		t.Fatalf("handleMessage = %v, %v; want nil, true", resp, ok)
+	}
+}
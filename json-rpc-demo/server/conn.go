@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+)
+
+// maxInFlight caps how many messages of one persistent connection are
+// processed at the same time; reading pauses while the limit is reached.
+const maxInFlight = 16
+
+// serveConn runs JSON-RPC over a persistent connection, whatever its framing:
+// next returns the next message and send writes one. Every message is a
+// request or batch handled like a POST to /rpc. Responses are sent as they
+// finish, so they may be out of order and are matched by id. The connection
+// gets an rpcSession, so subscriptions work over it too.
+//
+// When next returns io.EOF the peer is done sending, and pending calls still
+// get their answers. Any other error cancels them. serveConn returns that
+// error, or nil for io.EOF.
+func serveConn(ctx context.Context, next func() ([]byte, error), send func([]byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	session := newSession(send)
+	defer session.close()
+	ctx = withSession(ctx, session)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxInFlight)
+	for {
+		msg, err := next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				cancel()
+			} else {
+				err = nil
+			}
+			wg.Wait()
+			return err
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(msg []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			response, _ := handleMessage(withRequestID(ctx, newRequestID()), msg)
+			if response == nil {
+				return
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				log.Printf("failed to encode response: %v", err)
+				return
+			}
+			if err := send(data); err != nil {
+				log.Printf("failed to write response: %v", err)
+			}
+		}(msg)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useEcho registers an "echo" method that returns its params.
+func useEcho(t *testing.T) {
+	t.Helper()
+	useMethods(t)
+	Register("echo", func(_ context.Context, p json.RawMessage) (json.RawMessage, error) {
+		return p, nil
+	})
+}
+
+// servePipe runs serve on one end of a net.Pipe and returns the other end and
+// serve's result, which arrives once serve returns.
+func servePipe(t *testing.T, serve func(net.Conn) error) (net.Conn, <-chan error) {
+	t.Helper()
+	client, server := net.Pipe()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { client.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		defer server.Close()
+		done <- serve(server)
+	}()
+	return client, done
+}
+
+// waitServe returns the result of serve, failing the test if it does not stop.
+func waitServe(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed")
+		return nil
+	}
+}
+
+// decodeResponses maps each response id to its result, or to its error code.
+// Batch responses count as their entries.
+func decodeResponses(t *testing.T, msgs [][]byte) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	for i := 0; i < len(msgs); i++ {
+		msg := msgs[i]
+		if msg[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(msg, &batch); err != nil {
+				t.Fatalf("decode %q: %v", msg, err)
+			}
+			for _, entry := range batch {
+				msgs = append(msgs, entry)
+			}
+			continue
+		}
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  *rpcError       `json:"error"`
+			ID     json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("decode %q: %v", msg, err)
+		}
+		if resp.Error != nil {
+			got[string(resp.ID)] = fmt.Sprint(resp.Error.Code)
+		} else {
+			got[string(resp.ID)] = string(resp.Result)
+		}
+	}
+	return got
+}
+
+func TestReadContentLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string // messages read before the error
+		err   string   // "" for a clean io.EOF
+	}{
+		{
+			name:  "two messages and other headers",
+			input: "Content-Length: 2\r\n\r\n{}Content-Type: application/json\r\nContent-Length: 4\r\n\r\nnull",
+			want:  []string{"{}", "null"},
+		},
+		{name: "empty stream", input: ""},
+		{name: "missing header", input: "Content-Type: application/json\r\n\r\n{}", err: "missing Content-Length header"},
+		{name: "truncated body", input: "Content-Length: 10\r\n\r\n{}", err: "read body: unexpected EOF"},
+		{name: "truncated header", input: "Content-Length: 2\r\n", err: "read header"},
+		{name: "invalid length", input: "Content-Length: -1\r\n\r\n", err: `invalid Content-Length "-1"`},
+		{name: "too big", input: fmt.Sprintf("Content-Length: %d\r\n\r\n", maxMessageSize+1), err: "exceeds the"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.input))
+			var got []string
+			for {
+				msg, err := readContentLength(br)
+				if err != nil {
+					if tt.err == "" && err != io.EOF {
+						t.Errorf("error = %v, want io.EOF", err)
+					}
+					if tt.err != "" && (err == io.EOF || !strings.Contains(err.Error(), tt.err)) {
+						t.Errorf("error = %v, want %q", err, tt.err)
+					}
+					break
+				}
+				got = append(got, string(msg))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeContentLength(t *testing.T) {
+	useEcho(t)
+	client, done := servePipe(t, func(c net.Conn) error {
+		return serveContentLength(context.Background(), c, c)
+	})
+
+	// a request, a notification and a batch, then a truncated body that
+	// ends the connection
+	go func() {
+		for _, msg := range []string{
+			`{"jsonrpc": "2.0", "method": "echo", "params": [1], "id": 1}`,
+			`{"jsonrpc": "2.0", "method": "echo", "params": [2]}`,
+			`[{"jsonrpc": "2.0", "method": "echo", "params": [3], "id": 3}, {"jsonrpc": "2.0", "method": "nope", "id": 4}]`,
+		} {
+			writeContentLength(client, []byte(msg))
+		}
+	}()
+
+	br := bufio.NewReader(client)
+	var msgs [][]byte
+	for len(msgs) < 2 {
+		msg, err := readContentLength(br)
+		if err != nil {
+			t.Fatalf("read response %d: %v", len(msgs)+1, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	got := decodeResponses(t, msgs)
+	want := map[string]string{"1": "[1]", "3": "[3]", "4": "-32601"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("responses = %v, want %v", got, want)
+	}
+
+	fmt.Fprint(client, "Content-Length: 100\r\n\r\n{\"jsonrpc\"")
+	client.Close()
+	if err := waitServe(t, done); err == nil || !strings.Contains(err.Error(), "read body") {
+		t.Errorf("serveContentLength = %v, want a read body error", err)
+	}
+}
+
+func TestServeContentLengthMissingHeader(t *testing.T) {
+	useEcho(t)
+	client, done := servePipe(t, func(c net.Conn) error {
+		return serveContentLength(context.Background(), c, c)
+	})
+
+	fmt.Fprint(client, "Content-Type: application/json\r\n\r\n")
+	if err := waitServe(t, done); err == nil || !strings.Contains(err.Error(), "missing Content-Length") {
+		t.Errorf("serveContentLength = %v, want a missing header error", err)
+	}
+}
+
+func TestServeNDJSON(t *testing.T) {
+	useEcho(t)
+	client, done := servePipe(t, func(c net.Conn) error {
+		serveUnixConn(c)
+		return nil
+	})
+
+	// blank lines are skipped, and a bad line only fails itself
+	go fmt.Fprint(client, "{\"jsonrpc\": \"2.0\", \"method\": \"echo\", \"params\": [1], \"id\": 1}\n"+
+		"\n"+
+		"{not json\n"+
+		"{\"jsonrpc\": \"2.0\", \"method\": \"echo\", \"params\": {\"a\": \"b\"}, \"id\": \"two\"}\n")
+
+	scanner := bufio.NewScanner(client)
+	var msgs [][]byte
+	for len(msgs) < 3 && scanner.Scan() {
+		msgs = append(msgs, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	got := decodeResponses(t, msgs)
+	want := map[string]string{"1": "[1]", `"two"`: `{"a":"b"}`, "null": "-32700"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("responses = %v, want %v", got, want)
+	}
+
+	// serveUnixConn returns once the client hangs up
+	client.Close()
+	waitServe(t, done)
+}
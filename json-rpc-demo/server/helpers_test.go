@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// useMethods gives the test empty method tables and restores the real ones
+// when it ends.
+func useMethods(t *testing.T) {
+	t.Helper()
+	origRegistry, origSignatures, origTimeouts := methodRegistry, methodSignatures, methodTimeouts
+	methodRegistry = map[string]methodFunc{}
+	methodSignatures = map[string]methodSignature{}
+	methodTimeouts = map[string]time.Duration{}
+	t.Cleanup(func() {
+		methodRegistry, methodSignatures, methodTimeouts = origRegistry, origSignatures, origTimeouts
+	})
+}
+
+// call sends body through handleMessage and decodes the response into a
+// generic value, nil when there is none.
+func call(t *testing.T, body string) any {
+	t.Helper()
+	resp, _ := handleMessage(context.Background(), []byte(body))
+	if resp == nil {
+		return nil
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("encode response: %v", err)
+	}
+	return normalize(t, data)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// interceptor wraps every method call, for logging, metrics and the like.
+// The method name and request id are available from the context through
+// callFrom and requestIDFrom.
+type interceptor func(next methodFunc) methodFunc
+
+// interceptors run around every method call, the first entry outermost.
+// recoverPanics comes last so that the calls it turns into errors are still
+// logged and counted by the interceptors before it.
+var interceptors = []interceptor{logCalls, recordLatency, authorize, enforceTimeout, recoverPanics}
+
+func applyInterceptors(handler methodFunc) methodFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		handler = interceptors[i](handler)
+	}
+	return handler
+}
+
+// callInfo identifies the method call being dispatched.
+type callInfo struct {
+	method string
+	id     any // nil for notifications
+}
+
+type callKey struct{}
+
+type requestIDKey struct{}
+
+func withCall(ctx context.Context, method string, id any) context.Context {
+	return context.WithValue(ctx, callKey{}, callInfo{method: method, id: id})
+}
+
+func callFrom(ctx context.Context) callInfo {
+	call, _ := ctx.Value(callKey{}).(callInfo)
+	return call
+}
+
+// withRequestID tags everything done for one transport message (an HTTP
+// request or a message on a persistent connection) with id, so the log lines
+// of a batch can be told apart from those of other requests.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// logCalls writes one structured log line per call.
+func logCalls(next methodFunc) methodFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+		started := time.Now()
+		result, rpcErr := next(ctx, params)
+
+		call := callFrom(ctx)
+		attrs := []any{
+			"request_id", requestIDFrom(ctx),
+			"identity", identityFrom(ctx).name,
+			"method", call.method,
+			"id", call.id,
+			"duration", time.Since(started),
+		}
+		if rpcErr != nil {
+			slog.Warn("rpc call failed", append(attrs, "code", rpcErr.Code, "error", rpcErr.Message)...)
+		} else {
+			slog.Info("rpc call", attrs...)
+		}
+		return result, rpcErr
+	}
+}
+
+// recordLatency feeds the per-method latency histograms served at /metrics.
+func recordLatency(next methodFunc) methodFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+		started := time.Now()
+		result, rpcErr := next(ctx, params)
+		code := 0
+		if rpcErr != nil {
+			code = rpcErr.Code
+		}
+		metrics.observe(callFrom(ctx).method, code, time.Since(started))
+		return result, rpcErr
+	}
+}
+
+// enforceTimeout runs the call with the method's timeout applied to its
+// context. The handler runs on the caller's goroutine, so it has to return
+// once ctx is done: one that ignores ctx holds up its response, and its slot
+// in the batch or connection, until it returns. A call still running at the
+// deadline is answered with a timeout error even if it then succeeds.
+func enforceTimeout(next methodFunc) methodFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+		method := callFrom(ctx).method
+		timeout, ok := methodTimeouts[method]
+		if !ok {
+			timeout = defaultMethodTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		result, rpcErr := next(ctx, params)
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return nil, &rpcError{
+				Code:    codeMethodTimeout,
+				Message: "method timed out",
+				Data:    map[string]string{"method": method, "timeout": timeout.String()},
+			}
+		case ctx.Err() != nil:
+			return nil, &rpcError{Code: codeRequestCancelled, Message: "request cancelled"}
+		}
+		return result, rpcErr
+	}
+}
+
+// recoverPanics turns a panicking handler into a -32603 internal error. The
+// panic value and stack are logged, not sent to the client.
+func recoverPanics(next methodFunc) methodFunc {
+	return func(ctx context.Context, params json.RawMessage) (result any, rpcErr *rpcError) {
+		defer func() {
+			if v := recover(); v != nil {
+				slog.Error("rpc method panicked",
+					"request_id", requestIDFrom(ctx),
+					"method", callFrom(ctx).method,
+					"panic", fmt.Sprint(v),
+					"stack", string(debug.Stack()))
+				result, rpcErr = nil, &rpcError{Code: -32603, Message: "internal error"}
+			}
+		}()
+		return next(ctx, params)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInterceptorOrder(t *testing.T) {
+	useMethods(t)
+	origInterceptors := interceptors
+	t.Cleanup(func() { interceptors = origInterceptors })
+
+	var trace []string
+	record := func(name string) interceptor {
+		return func(next methodFunc) methodFunc {
+			return func(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+				trace = append(trace, name+" before")
+				result, rpcErr := next(ctx, params)
+				trace = append(trace, name+" after")
+				return result, rpcErr
+			}
+		}
+	}
+	interceptors = []interceptor{record("first"), record("second"), record("third")}
+	Register("trace", func(context.Context, struct{}) (int, error) {
+		trace = append(trace, "handler")
+		return 1, nil
+	})
+
+	call(t, `{"jsonrpc": "2.0", "method": "trace", "id": 1}`)
+	want := []string{"first before", "second before", "third before", "handler", "third after", "second after", "first after"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	useMethods(t)
+	Register("test.panic", func(context.Context, struct{}) (int, error) {
+		panic("boom")
+	})
+	Register("test.ok", func(context.Context, struct{}) (int, error) {
+		return 1, nil
+	})
+
+	panics := func() uint64 {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		if mm := metrics.methods["test.panic"]; mm != nil {
+			return mm.errors[-32603]
+		}
+		return 0
+	}
+	before := panics()
+
+	// the panic fails its own call only, and stays inside recordLatency
+	got := call(t, `[
+		{"jsonrpc": "2.0", "method": "test.panic", "id": 1},
+		{"jsonrpc": "2.0", "method": "test.ok", "id": 2}
+	]`)
+	want := normalize(t, []byte(`[
+		{"jsonrpc": "2.0", "error": {"code": -32603}, "id": 1},
+		{"jsonrpc": "2.0", "result": 1, "id": 2}
+	]`))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("responses = %v, want %v", got, want)
+	}
+
+	if n := panics() - before; n != 1 {
+		t.Errorf("recorded %d -32603 errors for test.panic, want 1", n)
+	}
+}
+
+func TestEnforceTimeoutWaitsForHandler(t *testing.T) {
+	useMethods(t)
+	var running atomic.Bool
+	Register("stubborn", func(context.Context, struct{}) (int, error) {
+		// ignores ctx on purpose
+		running.Store(true)
+		time.Sleep(50 * time.Millisecond)
+		running.Store(false)
+		return 1, nil
+	})
+	methodTimeouts["stubborn"] = 10 * time.Millisecond
+
+	// the deadline has passed, but no goroutine is left behind
+	got := call(t, `{"jsonrpc": "2.0", "method": "stubborn", "id": 1}`)
+	want := normalize(t, []byte(`{"jsonrpc": "2.0", "error": {"code": -32001}, "id": 1}`))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("response = %v, want %v", got, want)
+	}
+	if running.Load() {
+		t.Error("handler still running after the response")
+	}
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,6 +22,25 @@ const (
 	defaultServerAddr = ":8080"
 )
 
+// Implementation-defined server error codes (the spec reserves -32000 to -32099).
+const (
+	codeServerError      = -32000
+	codeMethodTimeout    = -32001
+	codeRequestCancelled = -32002
+	codeNoSession        = -32003
+	codeUnauthenticated  = -32004
+	codeForbidden        = -32005
+)
+
+var (
+	// batchParallelism caps how many entries of one batch run at the same time.
+	batchParallelism = runtime.NumCPU()
+	// defaultMethodTimeout bounds every method call that has no entry in methodTimeouts.
+	defaultMethodTimeout = 5 * time.Second
+	// methodTimeouts overrides defaultMethodTimeout for individual methods.
+	methodTimeouts = map[string]time.Duration{}
+)
+
 type rpcRequest struct {
 	JSONRPC string           `json:"jsonrpc"`
 	Method  string           `json:"method"`
@@ -37,15 +61,48 @@ type rpcError struct {
 	Data    any    `json:"data,omitempty"`
 }
 
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
 type methodFunc func(ctx context.Context, params json.RawMessage) (any, *rpcError)
 
 // methodRegistry maps method names to their Go handlers.
 var methodRegistry = map[string]methodFunc{}
 
 func init() {
-	methodRegistry["math.add"] = addNumbers
-	methodRegistry["math.sum"] = sumSlice
-	methodRegistry["text.concat"] = concatText
+	registerMath(mathService{})
+	Register("text.concat", concatText)
+	Register("events.subscribe", subscribe)
+	Register("events.unsubscribe", unsubscribe)
+	Register("events.publish", publish)
+	Register("auth.whoami", whoami)
+	Register("rpc.discover", discoverMethods)
+}
+
+// registerDebugMethods adds the debug.* methods, which let any caller tie up
+// the server or fill its log with stack traces; main only calls it with -debug.
+func registerDebugMethods() {
+	Register("debug.sleep", sleepFor)
+	Register("debug.panic", panicWith)
+	methodTimeouts["debug.sleep"] = time.Second
+}
+
+func main() {
+	flag.IntVar(&batchParallelism, "batch-parallelism", batchParallelism, "maximum number of batch entries executed concurrently")
+	flag.DurationVar(&defaultMethodTimeout, "method-timeout", defaultMethodTimeout, "default time limit for a single method call")
+	stdio := flag.Bool("stdio", false, "serve a single client over stdin/stdout (Content-Length framing) instead of HTTP")
+	unixSocket := flag.String("unix", "", "also accept newline-delimited JSON-RPC on this Unix socket path")
+	flag.BoolVar(&strictMode, "strict", strictMode, "follow the JSON-RPC 2.0 specification strictly, see strict.go")
+	authFile := flag.String("auth-config", "", "JSON file with bearer tokens, HMAC keys and the method policy (default: no authentication)")
+	debugMethods := flag.Bool("debug", false, "register the debug.sleep and debug.panic methods")
+	flag.Parse()
+	if batchParallelism < 1 {
+		log.Fatal("-batch-parallelism must be at least 1")
+	}
+	if *debugMethods {
+		registerDebugMethods()
+	}
 
 	methodNames := make([]string, 0, len(methodRegistry))
 	for name := range methodRegistry {
@@ -53,11 +110,37 @@ func init() {
 	}
 	sort.Strings(methodNames)
 	log.Printf("Registered JSON-RPC methods: %s", strings.Join(methodNames, ", "))
-}
+	if *authFile != "" {
+		settings, err := loadAuthConfig(*authFile)
+		if err != nil {
+			log.Fatalf("auth config: %v", err)
+		}
+		authn = settings
+		log.Printf("authentication enabled with %s", *authFile)
+	}
+
+	go publishClock()
+
+	if *stdio {
+		log.Printf("JSON-RPC server reading from stdin")
+		if err := serveStdio(context.Background()); err != nil {
+			log.Fatalf("stdio error: %v", err)
+		}
+		return
+	}
+
+	if *unixSocket != "" {
+		if _, err := listenUnix(*unixSocket); err != nil {
+			log.Fatalf("unix socket error: %v", err)
+		}
+		log.Printf("JSON-RPC server listening on unix socket %s", *unixSocket)
+	}
 
-func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/rpc", rpcHandler)
+	mux.HandleFunc("/openrpc.json", requirePolicy("rpc.discover", openRPCHandler))
+	mux.HandleFunc("/ws", wsHandler)
+	mux.HandleFunc("/metrics", requirePolicy(metricsPolicyName, metricsHandler))
 
 	server := &http.Server{
 		Addr:              defaultServerAddr,
@@ -65,7 +148,7 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	log.Printf("JSON-RPC server listening on http://localhost%s/rpc", defaultServerAddr)
+	log.Printf("JSON-RPC server listening on http://localhost%s/rpc (WebSocket: ws://localhost%s/ws)", defaultServerAddr, defaultServerAddr)
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server error: %v", err)
 	}
@@ -83,50 +166,86 @@ func rpcHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	trimmed := strings.TrimSpace(string(body))
-	if trimmed == "" {
-		writeError(w, http.StatusBadRequest, rpcError{Code: -32700, Message: "empty request body"}, nil)
-		return
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = newRequestID()
 	}
+	w.Header().Set("X-Request-ID", requestID)
 
-	if strings.HasPrefix(trimmed, "[") {
-		handleBatch(w, r.Context(), body)
-		return
+	ctx := withIdentity(withRequestID(r.Context(), requestID), authn.authenticate(r, body))
+	response, ok := handleMessage(ctx, body)
+	switch {
+	case response == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case !ok:
+		writeJSON(w, http.StatusBadRequest, response)
+	default:
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// handleMessage processes one JSON-RPC message (a single request or a batch)
+// independently of the transport. It returns the response to send back, or nil
+// when there is none because the message held only notifications. ok is false
+// when the message itself could not be parsed.
+func handleMessage(ctx context.Context, body []byte) (response any, ok bool) {
+	if strictMode {
+		return handleStrictMessage(ctx, body)
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return errorResponse(rpcError{Code: -32700, Message: "empty request body"}), false
+	}
+
+	if trimmed[0] == '[' {
+		return handleBatch(ctx, trimmed)
 	}
 
 	var req rpcRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeError(w, http.StatusBadRequest, rpcError{Code: -32700, Message: "invalid JSON"}, nil)
-		return
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return errorResponse(rpcError{Code: -32700, Message: "invalid JSON"}), false
 	}
 
-	resp := dispatchRequest(r.Context(), req)
-	if resp == nil {
-		w.WriteHeader(http.StatusNoContent)
-		return
+	if resp := dispatchRequest(ctx, req); resp != nil {
+		return resp, true
 	}
-	writeJSON(w, http.StatusOK, resp)
+	return nil, true
 }
 
-func handleBatch(w http.ResponseWriter, ctx context.Context, body []byte) {
+func handleBatch(ctx context.Context, body []byte) (any, bool) {
 	var requests []rpcRequest
 	if err := json.Unmarshal(body, &requests); err != nil {
-		writeError(w, http.StatusBadRequest, rpcError{Code: -32700, Message: "invalid JSON batch"}, nil)
-		return
+		return errorResponse(rpcError{Code: -32700, Message: "invalid JSON batch"}), false
+	}
+
+	// Entries run concurrently, bounded by batchParallelism. Each goroutine writes
+	// only its own slot, so responses keep the order (and ids) of the requests.
+	results := make([]*rpcResponse, len(requests))
+	slots := make(chan struct{}, batchParallelism)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, req rpcRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = dispatchRequest(ctx, req)
+		}(i, req)
 	}
+	wg.Wait()
 
-	responses := make([]rpcResponse, 0, len(requests))
-	for _, req := range requests {
-		if resp := dispatchRequest(ctx, req); resp != nil {
+	responses := make([]rpcResponse, 0, len(results))
+	for _, resp := range results {
+		if resp != nil {
 			responses = append(responses, *resp)
 		}
 	}
 
 	if len(responses) == 0 {
-		w.WriteHeader(http.StatusNoContent)
-		return
+		return nil, true
 	}
-	writeJSON(w, http.StatusOK, responses)
+	return responses, true
 }
 
 func dispatchRequest(ctx context.Context, req rpcRequest) *rpcResponse {
@@ -145,7 +264,8 @@ func dispatchRequest(ctx context.Context, req rpcRequest) *rpcResponse {
 		return &rpcResponse{JSONRPC: jsonRPCVersion, Error: &rpcError{Code: -32601, Message: "method not found"}, ID: idValue}
 	}
 
-	result, rpcErr := handler(ctx, req.Params)
+	ctx = withCall(ctx, req.Method, idValue)
+	result, rpcErr := applyInterceptors(handler)(ctx, req.Params)
 	if rpcErr != nil {
 		return &rpcResponse{JSONRPC: jsonRPCVersion, Error: rpcErr, ID: idValue}
 	}
@@ -156,47 +276,58 @@ func dispatchRequest(ctx context.Context, req rpcRequest) *rpcResponse {
 	return &rpcResponse{JSONRPC: jsonRPCVersion, Result: result, ID: idValue}
 }
 
-func addNumbers(_ context.Context, params json.RawMessage) (any, *rpcError) {
-	var numbers struct {
-		A float64 `json:"a"`
-		B float64 `json:"b"`
-	}
-	if err := json.Unmarshal(params, &numbers); err != nil {
-		return nil, &rpcError{Code: -32602, Message: "expected params object with 'a' and 'b'"}
-	}
-	return map[string]float64{"sum": numbers.A + numbers.B}, nil
+type concatParams struct {
+	Parts     []string `json:"parts,required"`
+	Separator string   `json:"separator"`
 }
 
-func sumSlice(_ context.Context, params json.RawMessage) (any, *rpcError) {
-	var values []float64
-	if err := json.Unmarshal(params, &values); err != nil {
-		return nil, &rpcError{Code: -32602, Message: "expected params array of numbers"}
-	}
-	var sum float64
-	for _, v := range values {
-		sum += v
-	}
-	return map[string]float64{"sum": sum}, nil
+type concatResult struct {
+	Text string `json:"text"`
 }
 
-func concatText(_ context.Context, params json.RawMessage) (any, *rpcError) {
-	var args struct {
-		Parts     []string `json:"parts"`
-		Separator string   `json:"separator"`
+func concatText(_ context.Context, p concatParams) (concatResult, error) {
+	if len(p.Parts) == 0 {
+		return concatResult{}, &rpcError{Code: -32602, Message: "parts must contain at least one string"}
 	}
-	if err := json.Unmarshal(params, &args); err != nil {
-		return nil, &rpcError{Code: -32602, Message: "expected params object with 'parts' and optional 'separator'"}
+	if p.Separator == "" {
+		p.Separator = " "
 	}
+	return concatResult{Text: strings.Join(p.Parts, p.Separator)}, nil
+}
+
+type sleepParams struct {
+	Milliseconds int `json:"ms"`
+}
 
-	if len(args.Parts) == 0 {
-		return nil, &rpcError{Code: -32602, Message: "parts must contain at least one string"}
+type sleepResult struct {
+	Slept int `json:"slept"`
+}
+
+func sleepFor(ctx context.Context, p sleepParams) (sleepResult, error) {
+	if p.Milliseconds < 0 {
+		return sleepResult{}, &rpcError{Code: -32602, Message: "ms must not be negative"}
 	}
 
-	if args.Separator == "" {
-		args.Separator = " "
+	timer := time.NewTimer(time.Duration(p.Milliseconds) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return sleepResult{Slept: p.Milliseconds}, nil
+	case <-ctx.Done():
+		return sleepResult{}, fmt.Errorf("sleep interrupted: %w", ctx.Err())
 	}
+}
+
+type panicParams struct {
+	Message string `json:"message"`
+}
 
-	return map[string]string{"text": strings.Join(args.Parts, args.Separator)}, nil
+// panicWith always panics; it shows that a failing handler only fails its own call.
+func panicWith(_ context.Context, p panicParams) (struct{}, error) {
+	if p.Message == "" {
+		p.Message = "debug.panic called"
+	}
+	panic(p.Message)
 }
 
 func decodeID(raw *json.RawMessage) any {
@@ -228,6 +359,10 @@ func writeError(w http.ResponseWriter, status int, err rpcError, id any) {
 	writeJSON(w, status, rpcResponse{JSONRPC: jsonRPCVersion, Error: &err, ID: id})
 }
 
+func errorResponse(err rpcError) *rpcResponse {
+	return &rpcResponse{JSONRPC: jsonRPCVersion, Error: &err}
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		started := time.Now()
@@ -248,11 +383,8 @@ func (r *statusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
-func init() {
-	methodNames := make([]string, 0, len(methodRegistry))
-	for name := range methodRegistry {
-		methodNames = append(methodNames, name)
-	}
-	sort.Strings(methodNames)
-	log.Printf("Registered JSON-RPC methods: %s", strings.Join(methodNames, ", "))
+// Unwrap lets http.ResponseController reach the underlying writer, which the
+// WebSocket upgrade needs for hijacking the connection.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
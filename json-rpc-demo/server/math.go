@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+
+	"json-rpc-demo/api"
+)
+
+// mathService implements api.Math; registerMath in math_rpc_gen.go adds its
+// methods to methodRegistry.
+type mathService struct{}
+
+func (mathService) Add(_ context.Context, p api.AddParams) (api.SumResult, error) {
+	return api.SumResult{Sum: p.A + p.B}, nil
+}
+
+func (mathService) Sum(_ context.Context, values []float64) (api.SumResult, error) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return api.SumResult{Sum: sum}, nil
+}
@@ -0,0 +1,11 @@
+// Code generated by rpcgen from api.Math. DO NOT EDIT.
+
+package main
+
+import api "json-rpc-demo/api"
+
+// registerMath adds the methods of api.Math to methodRegistry.
+func registerMath(impl api.Math) {
+	Register("math.add", impl.Add)
+	Register("math.sum", impl.Sum)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go-streamable-http/histogram"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the method latency histogram.
+var latencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// methodMetrics holds the latency histogram and error counts of one method.
+// The histogram type is shared with go-streamable-http.
+type methodMetrics struct {
+	latency *histogram.Histogram
+	errors  map[int]uint64 // by JSON-RPC error code
+}
+
+type rpcMetrics struct {
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+}
+
+var metrics = &rpcMetrics{methods: map[string]*methodMetrics{}}
+
+// observe records one call; code is 0 for a successful call.
+func (m *rpcMetrics) observe(method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mm, ok := m.methods[method]
+	if !ok {
+		mm = &methodMetrics{latency: histogram.New(latencyBuckets), errors: map[int]uint64{}}
+		m.methods[method] = mm
+	}
+	mm.latency.Observe(d)
+	if code != 0 {
+		mm.errors[code]++
+	}
+}
+
+// writeTo writes all metrics in the Prometheus text format.
+func (m *rpcMetrics) writeTo(w http.ResponseWriter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.methods))
+	for name := range m.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []byte
+	printf := func(format string, args ...any) {
+		out = fmt.Appendf(out, format, args...)
+	}
+
+	printf("# HELP rpc_method_duration_seconds Time spent in JSON-RPC method calls.\n")
+	printf("# TYPE rpc_method_duration_seconds histogram\n")
+	for _, name := range names {
+		out = m.methods[name].latency.AppendText(out, "rpc_method_duration_seconds", fmt.Sprintf("method=%q", name))
+	}
+
+	printf("# HELP rpc_method_errors_total JSON-RPC method calls that returned an error.\n")
+	printf("# TYPE rpc_method_errors_total counter\n")
+	for _, name := range names {
+		errs := m.methods[name].errors
+		codes := make([]int, 0, len(errs))
+		for code := range errs {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			printf("rpc_method_errors_total{method=%q,code=\"%d\"} %d\n", name, code, errs[code])
+		}
+	}
+
+	_, err := w.Write(out)
+	return err
+}
+
+func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.writeTo(w); err != nil {
+		log.Printf("failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// openRPCVersion is the version of the OpenRPC specification the document follows.
+	openRPCVersion = "1.2.6"
+	// openRPCMetaSchema is the conventional result schema of rpc.discover.
+	openRPCMetaSchema = "https://raw.githubusercontent.com/open-rpc/meta-schema/master/schema.json"
+)
+
+// The document types below cover the subset of OpenRPC this server produces.
+
+type openRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       openRPCInfo       `json:"info"`
+	Methods    []openRPCMethod   `json:"methods"`
+	Components openRPCComponents `json:"components"`
+}
+
+type openRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openRPCMethod struct {
+	Name           string                     `json:"name"`
+	ParamStructure string                     `json:"paramStructure"`
+	Params         []openRPCContentDescriptor `json:"params"`
+	Result         openRPCContentDescriptor   `json:"result"`
+	// ParamsSchema describes params that are not a struct (for example the
+	// number array of math.sum). The array itself is the params value, which
+	// OpenRPC content descriptors cannot express, hence the extension field.
+	ParamsSchema *jsonSchema `json:"x-params-schema,omitempty"`
+}
+
+type openRPCContentDescriptor struct {
+	Name     string      `json:"name"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *jsonSchema `json:"schema"`
+}
+
+type openRPCComponents struct {
+	Schemas map[string]*jsonSchema `json:"schemas,omitempty"`
+}
+
+// jsonSchema is the subset of JSON Schema needed to describe Go types.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+}
+
+// discoverMethods implements rpc.discover.
+func discoverMethods(_ context.Context, _ struct{}) (openRPCDocument, error) {
+	return buildOpenRPCDocument(), nil
+}
+
+// openRPCHandler serves the same document as rpc.discover at GET /openrpc.json.
+func openRPCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "OpenRPC document is only available via GET", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, buildOpenRPCDocument())
+}
+
+// buildOpenRPCDocument describes every method in methodRegistry. Methods added
+// through Register get param and result schemas derived from their Go types;
+// raw methodFunc entries are listed without schemas.
+func buildOpenRPCDocument() openRPCDocument {
+	names := make([]string, 0, len(methodRegistry))
+	for name := range methodRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gen := &schemaGenerator{components: map[string]*jsonSchema{}}
+	doc := openRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info:    openRPCInfo{Title: "JSON-RPC Go Demo", Version: "1.0.0"},
+		Methods: make([]openRPCMethod, 0, len(names)),
+	}
+	for _, name := range names {
+		method := openRPCMethod{
+			Name:           name,
+			ParamStructure: "either",
+			Params:         []openRPCContentDescriptor{},
+			Result:         openRPCContentDescriptor{Name: "result", Schema: &jsonSchema{}},
+		}
+
+		if sig, ok := methodSignatures[name]; ok {
+			if name == "rpc.discover" {
+				method.Result = openRPCContentDescriptor{Name: "OpenRPC Schema", Schema: &jsonSchema{Ref: openRPCMetaSchema}}
+			} else {
+				method.Result.Schema = gen.schema(sig.result)
+			}
+
+			params := sig.params
+			for params.Kind() == reflect.Pointer {
+				params = params.Elem()
+			}
+			if params.Kind() == reflect.Struct {
+				for _, field := range structFields(params) {
+					method.Params = append(method.Params, openRPCContentDescriptor{
+						Name:     field.name,
+						Required: field.required,
+						Schema:   gen.schema(field.typ),
+					})
+				}
+			} else {
+				method.ParamStructure = "by-position"
+				method.ParamsSchema = gen.schema(params)
+			}
+		}
+		doc.Methods = append(doc.Methods, method)
+	}
+
+	if len(gen.components) > 0 {
+		doc.Components.Schemas = gen.components
+	}
+	return doc
+}
+
+// schemaGenerator derives JSON schemas from Go types. Named struct types are
+// stored once in components and referenced with $ref, which also keeps
+// recursive types finite. Anonymous structs are described inline.
+type schemaGenerator struct {
+	components map[string]*jsonSchema
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// marshalsWith reports whether encoding/json uses iface to encode t. Struct
+// fields are addressable, so methods with pointer receivers count too.
+func marshalsWith(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *jsonSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	case t == rawMessageType, marshalsWith(t, jsonMarshalerType):
+		// the JSON shape is up to the type's own marshalling
+		return &jsonSchema{}
+	case marshalsWith(t, textMarshalerType):
+		return &jsonSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes []byte as a base64 string
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = nil // placeholder so recursive references stop here
+			g.components[name] = g.structSchema(t)
+		}
+		return &jsonSchema{Ref: "#/components/schemas/" + name}
+	default:
+		// interfaces and anything else can hold any JSON value
+		return &jsonSchema{}
+	}
+}
+
+// structSchema lists the struct's JSON fields; the ones tagged ",required" are
+// required, the same fields bindParams insists on.
+func (g *schemaGenerator) structSchema(t reflect.Type) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}}
+	for _, field := range structFields(t) {
+		s.Properties[field.name] = g.schema(field.typ)
+		if field.required {
+			s.Required = append(s.Required, field.name)
+		}
+	}
+	return s
+}
+
+// componentName keys a named type by its package path and name, so that
+// types of the same name from different packages do not overwrite each other.
+// Characters that OpenRPC does not allow in component keys become '_'.
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	if t.PkgPath() != "" {
+		name = t.PkgPath() + "." + name
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '/':
+			return '.'
+		case r == '.', r == '-', r == '_', r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"json-rpc-demo/api"
+)
+
+// AddParams shares its name with api.AddParams on purpose.
+type AddParams struct {
+	C int `json:"c"`
+}
+
+// discover calls rpc.discover and decodes the document it returns.
+func discover(t *testing.T) openRPCDocument {
+	t.Helper()
+	resp, _ := handleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "method": "rpc.discover", "id": 1}`))
+	data, err := json.Marshal(resp.(*rpcResponse).Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc openRPCDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDiscoverMatchesRegistry(t *testing.T) {
+	// runs against the methods registered by init
+	doc := discover(t)
+
+	var registered, listed []string
+	for name := range methodRegistry {
+		registered = append(registered, name)
+	}
+	sort.Strings(registered)
+	for _, method := range doc.Methods {
+		listed = append(listed, method.Name)
+	}
+	if !reflect.DeepEqual(listed, registered) {
+		t.Fatalf("rpc.discover lists %v, registered are %v", listed, registered)
+	}
+
+	for _, method := range doc.Methods {
+		sig := methodSignatures[method.Name]
+		if sig.params.Kind() != reflect.Struct {
+			continue
+		}
+
+		// the params marked required are exactly the ones bindParams asks for
+		var names, required, missing []string
+		for _, param := range method.Params {
+			names = append(names, param.Name)
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+		var fields []string
+		for _, field := range structFields(sig.params) {
+			fields = append(fields, field.name)
+		}
+		if rpcErr := bindParams(json.RawMessage(`{}`), reflect.New(sig.params).Interface()); rpcErr != nil {
+			for _, detail := range rpcErr.Data.(map[string]any)["errors"].([]paramError) {
+				missing = append(missing, detail.Field)
+			}
+		}
+		sort.Strings(required)
+		if !reflect.DeepEqual(names, fields) {
+			t.Errorf("%s: params %v, want %v", method.Name, names, fields)
+		}
+		if !reflect.DeepEqual(required, missing) {
+			t.Errorf("%s: required params %v, but {} is rejected for %v", method.Name, required, missing)
+		}
+	}
+
+	for _, method := range doc.Methods {
+		checkRefs(t, doc, method.Name, method.Result.Schema)
+		checkRefs(t, doc, method.Name, method.ParamsSchema)
+		for _, param := range method.Params {
+			checkRefs(t, doc, method.Name, param.Schema)
+		}
+	}
+}
+
+// checkRefs fails for every local $ref in s that has no component.
+func checkRefs(t *testing.T, doc openRPCDocument, method string, s *jsonSchema) {
+	t.Helper()
+	if s == nil {
+		return
+	}
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok && doc.Components.Schemas[name] == nil {
+		t.Errorf("%s: dangling $ref %s", method, s.Ref)
+	}
+	checkRefs(t, doc, method, s.Items)
+	checkRefs(t, doc, method, s.AdditionalProperties)
+	for _, p := range s.Properties {
+		checkRefs(t, doc, method, p)
+	}
+}
+
+// itemResult references two types called AddParams from different packages.
+type itemResult struct {
+	Item *struct {
+		Base Base `json:"base"`
+	} `json:"item"`
+	Local  AddParams     `json:"local"`
+	Shared api.AddParams `json:"shared"`
+}
+
+func TestOpenRPCComponents(t *testing.T) {
+	useMethods(t)
+	Register("rpc.discover", discoverMethods)
+	Register("item", func(context.Context, itemParams) (itemResult, error) { return itemResult{}, nil })
+	doc := discover(t)
+
+	local, base, result := componentName(reflect.TypeOf(AddParams{})), componentName(reflect.TypeOf(Base{})), componentName(reflect.TypeOf(itemResult{}))
+	var names []string
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"json-rpc-demo.api.AddParams", local, base, result}
+	sort.Strings(want)
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("components = %v, want %v", names, want)
+	}
+	if !strings.HasSuffix(local, ".AddParams") || local == "json-rpc-demo.api.AddParams" {
+		t.Errorf("local AddParams is keyed %q", local)
+	}
+
+	schemas := doc.Components.Schemas
+	if got := schemas["json-rpc-demo.api.AddParams"].Required; !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("api.AddParams required = %v, want [a b]", got)
+	}
+	if got := schemas[local].Properties; got["c"] == nil || len(got) != 1 {
+		t.Errorf("local AddParams properties = %v, want only c", got)
+	}
+	// the anonymous struct is described inline
+	if item := schemas[result].Properties["item"]; item.Type != "object" || item.Properties["base"].Ref != "#/components/schemas/"+base {
+		t.Errorf("item = %+v, want an inline object referencing %s", item, base)
+	}
+
+	// embedded fields are promoted
+	var params, required []string
+	for _, param := range doc.Methods[0].Params {
+		params = append(params, param.Name)
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+	if want := []string{"id", "note", "name", "count"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("item params = %v, want %v", params, want)
+	}
+	if want := []string{"id", "count"}; !reflect.DeepEqual(required, want) {
+		t.Errorf("item required params = %v, want %v", required, want)
+	}
+}
+
+type valueJSON struct{ X int }
+
+func (valueJSON) MarshalJSON() ([]byte, error) { return []byte(`1`), nil }
+
+type pointerJSON struct{ X int }
+
+func (*pointerJSON) MarshalJSON() ([]byte, error) { return []byte(`1`), nil }
+
+type pointerText struct{ X int }
+
+func (*pointerText) MarshalText() ([]byte, error) { return []byte(`x`), nil }
+
+func TestSchemaMarshalers(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  reflect.Type
+		want jsonSchema
+	}{
+		{"value receiver json.Marshaler", reflect.TypeOf(valueJSON{}), jsonSchema{}},
+		{"pointer receiver json.Marshaler", reflect.TypeOf(pointerJSON{}), jsonSchema{}},
+		{"pointer to json.Marshaler", reflect.TypeOf(&pointerJSON{}), jsonSchema{}},
+		{"pointer receiver TextMarshaler", reflect.TypeOf(pointerText{}), jsonSchema{Type: "string"}},
+		{"time.Time", reflect.TypeOf(time.Time{}), jsonSchema{Type: "string", Format: "date-time"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &schemaGenerator{components: map[string]*jsonSchema{}}
+			if got := g.schema(tt.typ); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("schema = %+v, want %+v", *got, tt.want)
+			}
+			if len(g.components) != 0 {
+				t.Errorf("components = %v, want none", g.components)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// notificationMethod is the method name of server-pushed subscription notifications.
+const notificationMethod = "events.message"
+
+// sessionOutbox is how many notifications may wait for a slow client before
+// new ones are dropped.
+const sessionOutbox = 64
+
+// rpcSession is a client connection that stays open between requests, so the
+// server can push notifications to it. Persistent transports create one per
+// connection and attach it to the context of every request they dispatch.
+type rpcSession struct {
+	outbox chan []byte
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	subs   map[string]string // subscription id -> topic
+	closed bool              // set by close; no subscriptions are added afterwards
+}
+
+// newSession starts a session whose notifications are written with send.
+func newSession(send func([]byte) error) *rpcSession {
+	s := &rpcSession{
+		outbox: make(chan []byte, sessionOutbox),
+		done:   make(chan struct{}),
+		subs:   map[string]string{},
+	}
+	go func() {
+		for {
+			select {
+			case msg := <-s.outbox:
+				if err := send(msg); err != nil {
+					log.Printf("failed to push notification: %v", err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// notify queues a JSON-RPC notification without blocking. It reports false
+// when the session is closed or its outbox is full.
+func (s *rpcSession) notify(method string, params any) bool {
+	msg, err := json.Marshal(rpcNotification{JSONRPC: jsonRPCVersion, Method: method, Params: params})
+	if err != nil {
+		log.Printf("failed to encode notification: %v", err)
+		return false
+	}
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.outbox <- msg:
+		return true
+	default:
+		log.Printf("dropping %s notification: client is not keeping up", method)
+		return false
+	}
+}
+
+// close removes the session's subscriptions and stops pushing notifications.
+func (s *rpcSession) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		ids := make([]string, 0, len(s.subs))
+		for id := range s.subs {
+			ids = append(ids, id)
+		}
+		s.mu.Unlock()
+		for _, id := range ids {
+			topics.unsubscribe(s, id)
+		}
+	})
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, s *rpcSession) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+func sessionFrom(ctx context.Context) *rpcSession {
+	s, _ := ctx.Value(sessionKey{}).(*rpcSession)
+	return s
+}
+
+// topicRegistry tracks which sessions subscribed to which topic.
+type topicRegistry struct {
+	mu     sync.Mutex
+	nextID atomic.Uint64
+	topics map[string]map[string]*rpcSession // topic -> subscription id -> session
+}
+
+var topics = &topicRegistry{topics: map[string]map[string]*rpcSession{}}
+
+// subscribe adds a subscription for the session and returns its id. It
+// reports false once the session is closed: the check and both insertions
+// happen under s.mu, so close either sees the new subscription and removes it
+// or the subscription is never added.
+func (t *topicRegistry) subscribe(s *rpcSession, topic string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", false
+	}
+
+	id := fmt.Sprintf("sub-%d", t.nextID.Add(1))
+	s.subs[id] = topic
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	subs, ok := t.topics[topic]
+	if !ok {
+		subs = map[string]*rpcSession{}
+		t.topics[topic] = subs
+	}
+	subs[id] = s
+	return id, true
+}
+
+// unsubscribe removes one of the session's subscriptions and reports whether it existed.
+func (t *topicRegistry) unsubscribe(s *rpcSession, id string) bool {
+	s.mu.Lock()
+	topic, ok := s.subs[id]
+	delete(s.subs, id)
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.topics[topic], id)
+	if len(t.topics[topic]) == 0 {
+		delete(t.topics, topic)
+	}
+	return true
+}
+
+// publish pushes data to every subscriber of topic and returns how many
+// notifications were queued.
+func (t *topicRegistry) publish(topic string, data any) int {
+	t.mu.Lock()
+	subs := make(map[string]*rpcSession, len(t.topics[topic]))
+	for id, s := range t.topics[topic] {
+		subs[id] = s
+	}
+	t.mu.Unlock()
+
+	delivered := 0
+	for id, s := range subs {
+		if s.notify(notificationMethod, eventParams{Subscription: id, Topic: topic, Data: data}) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+type eventParams struct {
+	Subscription string `json:"subscription"`
+	Topic        string `json:"topic"`
+	Data         any    `json:"data"`
+}
+
+type subscribeParams struct {
+	Topic string `json:"topic,required"`
+}
+
+type subscribeResult struct {
+	Subscription string `json:"subscription"`
+}
+
+func subscribe(ctx context.Context, p subscribeParams) (subscribeResult, error) {
+	s := sessionFrom(ctx)
+	if s == nil {
+		return subscribeResult{}, &rpcError{Code: codeNoSession, Message: "subscriptions need a persistent connection (WebSocket, stdio or Unix socket)"}
+	}
+	if p.Topic == "" {
+		return subscribeResult{}, &rpcError{Code: -32602, Message: "topic is required"}
+	}
+	id, ok := topics.subscribe(s, p.Topic)
+	if !ok {
+		return subscribeResult{}, &rpcError{Code: codeNoSession, Message: "the connection is closing"}
+	}
+	return subscribeResult{Subscription: id}, nil
+}
+
+type unsubscribeParams struct {
+	Subscription string `json:"subscription,required"`
+}
+
+type unsubscribeResult struct {
+	Unsubscribed bool `json:"unsubscribed"`
+}
+
+func unsubscribe(ctx context.Context, p unsubscribeParams) (unsubscribeResult, error) {
+	s := sessionFrom(ctx)
+	if s == nil {
+		return unsubscribeResult{}, &rpcError{Code: codeNoSession, Message: "subscriptions need a persistent connection (WebSocket, stdio or Unix socket)"}
+	}
+	return unsubscribeResult{Unsubscribed: topics.unsubscribe(s, p.Subscription)}, nil
+}
+
+type publishParams struct {
+	Topic string          `json:"topic,required"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type publishResult struct {
+	Delivered int `json:"delivered"`
+}
+
+func publish(_ context.Context, p publishParams) (publishResult, error) {
+	if p.Topic == "" {
+		return publishResult{}, &rpcError{Code: -32602, Message: "topic is required"}
+	}
+	return publishResult{Delivered: topics.publish(p.Topic, p.Data)}, nil
+}
+
+// publishClock feeds the built-in "clock" topic once per second.
+func publishClock() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		topics.publish("clock", map[string]string{"time": now.Format(time.RFC3339)})
+	}
+}
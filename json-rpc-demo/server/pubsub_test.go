@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// subscribers returns how many subscriptions topic has.
+func subscribers(topic string) int {
+	topics.mu.Lock()
+	defer topics.mu.Unlock()
+	return len(topics.topics[topic])
+}
+
+func TestSubscribeClosedSession(t *testing.T) {
+	const topic = "test.closed"
+	s := newSession(func([]byte) error { return nil })
+	if _, ok := topics.subscribe(s, topic); !ok {
+		t.Fatal("subscribe failed on an open session")
+	}
+	s.close()
+	if n := subscribers(topic); n != 0 {
+		t.Errorf("%d subscriptions left after close", n)
+	}
+	if _, ok := topics.subscribe(s, topic); ok {
+		t.Error("subscribe succeeded after close")
+	}
+	if n := subscribers(topic); n != 0 {
+		t.Errorf("%d subscriptions after subscribing a closed session", n)
+	}
+}
+
+func TestSubscribeRacesClose(t *testing.T) {
+	const topic = "test.race"
+	for i := 0; i < 200; i++ {
+		s := newSession(func([]byte) error { return nil })
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				topics.subscribe(s, topic)
+			}()
+		}
+		s.close()
+		wg.Wait()
+		// whichever subscriptions got in before close were removed by it
+		if n := subscribers(topic); n != 0 {
+			t.Fatalf("iteration %d: %d subscriptions outlived their session", i, n)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Register adds a typed method to methodRegistry. Params are decoded into P
+// from either a named object or a positional array (array elements fill the
+// struct fields in declaration order), and the returned R becomes the result.
+// Fields tagged `json:"name,required"` must be present; all others may be left
+// out and keep their zero value. rpc.discover marks the same fields required.
+//
+// Decode failures are reported as -32602 with one entry per offending field in
+// error.data. Returning an *rpcError from fn sends it as is; any other error
+// becomes a -32000 server error.
+func Register[P, R any](name string, fn func(context.Context, P) (R, error)) {
+	methodSignatures[name] = methodSignature{
+		params: reflect.TypeOf((*P)(nil)).Elem(),
+		result: reflect.TypeOf((*R)(nil)).Elem(),
+	}
+	methodRegistry[name] = func(ctx context.Context, raw json.RawMessage) (any, *rpcError) {
+		var params P
+		if rpcErr := bindParams(raw, &params); rpcErr != nil {
+			return nil, rpcErr
+		}
+		result, err := fn(ctx, params)
+		if err != nil {
+			return nil, toRPCError(err)
+		}
+		return result, nil
+	}
+}
+
+// methodSignature keeps the Go types of a registered method for rpc.discover.
+type methodSignature struct {
+	params reflect.Type
+	result reflect.Type
+}
+
+// methodSignatures holds the types of every method added through Register.
+var methodSignatures = map[string]methodSignature{}
+
+// paramError describes why a single field could not be decoded.
+type paramError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func toRPCError(err error) *rpcError {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &rpcError{Code: codeServerError, Message: err.Error()}
+}
+
+// bindParams decodes raw into dst, which must be a pointer. Missing or null
+// params leave dst at its zero value, unless dst is a struct with required
+// fields; a pointer to a struct stays nil.
+func bindParams(raw json.RawMessage, dst any) *rpcError {
+	v := reflect.ValueOf(dst).Elem()
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		return invalidParams(missingFields(structFields(v.Type()), nil))
+	}
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	var details []paramError
+	switch {
+	case trimmed[0] != '{' && trimmed[0] != '[':
+		details = []paramError{{Message: "params must be an object or an array"}}
+	case v.Kind() == reflect.Struct && trimmed[0] == '{':
+		details = bindObject(trimmed, v)
+	case v.Kind() == reflect.Struct:
+		details = bindPositional(trimmed, v)
+	default:
+		details = bindValue("", trimmed, v)
+	}
+
+	return invalidParams(details)
+}
+
+// invalidParams turns field errors into a -32602 error, nil when there are none.
+func invalidParams(details []paramError) *rpcError {
+	if len(details) == 0 {
+		return nil
+	}
+	return &rpcError{Code: -32602, Message: "invalid params", Data: map[string]any{"errors": details}}
+}
+
+// missingFields reports the required fields that were not given.
+func missingFields(fields []fieldInfo, given map[string]bool) []paramError {
+	var details []paramError
+	for _, field := range fields {
+		if field.required && !given[field.name] {
+			details = append(details, paramError{Field: field.name, Message: "missing required field"})
+		}
+	}
+	return details
+}
+
+// bindObject decodes named params field by field so that every bad field is reported.
+func bindObject(raw []byte, v reflect.Value) []paramError {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return []paramError{{Message: err.Error()}}
+	}
+
+	fields := structFields(v.Type())
+	given := map[string]bool{}
+	var details []paramError
+	for key, value := range values {
+		field, ok := lookupField(fields, key)
+		if !ok {
+			details = append(details, paramError{Field: key, Message: "unknown field"})
+			continue
+		}
+		given[field.name] = true
+		details = append(details, bindValue(field.name, value, fieldByIndex(v, field.index))...)
+	}
+	details = append(details, missingFields(fields, given)...)
+	sort.Slice(details, func(i, j int) bool { return details[i].Field < details[j].Field })
+	return details
+}
+
+// bindPositional assigns array elements to the struct fields in declaration order.
+func bindPositional(raw []byte, v reflect.Value) []paramError {
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return []paramError{{Message: err.Error()}}
+	}
+
+	fields := structFields(v.Type())
+	if len(values) > len(fields) {
+		return []paramError{{
+			Field:   fmt.Sprint(len(fields)),
+			Message: fmt.Sprintf("too many positional params: got %d, expected at most %d", len(values), len(fields)),
+		}}
+	}
+
+	var details []paramError
+	for i, value := range values {
+		details = append(details, bindValue(fields[i].name, value, fieldByIndex(v, fields[i].index))...)
+	}
+	return append(details, missingFields(fields[len(values):], nil)...)
+}
+
+// bindValue decodes a single JSON value into v and names the field on failure.
+func bindValue(path string, raw []byte, v reflect.Value) []paramError {
+	err := json.Unmarshal(raw, v.Addr().Interface())
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := path
+		if typeErr.Field != "" {
+			field = strings.TrimPrefix(path+"."+typeErr.Field, ".")
+		}
+		// "number 1.5" for an int field: the JSON type is right, so name the Go type instead
+		want := jsonTypeName(typeErr.Type)
+		if strings.HasPrefix(typeErr.Value, want) {
+			want = typeErr.Type.String()
+		}
+		return []paramError{{Field: field, Message: fmt.Sprintf("expected %s, got %s", want, typeErr.Value)}}
+	}
+	return []paramError{{Field: path, Message: err.Error()}}
+}
+
+type fieldInfo struct {
+	name     string
+	index    []int // path through embedded structs, as for reflect.Value.FieldByIndex
+	typ      reflect.Type
+	tagged   bool
+	required bool
+}
+
+// structFields lists the JSON fields of t in declaration order. Fields of
+// embedded structs are promoted the way encoding/json does it: a field hides
+// deeper fields of the same name, and of several fields at the same depth only
+// a tagged one survives.
+func structFields(t reflect.Type) []fieldInfo {
+	all := collectFields(t, nil, map[reflect.Type]bool{})
+	var fields []fieldInfo
+	for _, f := range all {
+		if dominantField(all, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// collectFields lists the exported fields of t and of its untagged embedded
+// structs, depth first. visiting stops embedding cycles through pointers.
+func collectFields(t reflect.Type, parent []int, visiting map[reflect.Type]bool) []fieldInfo {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int(nil), parent...), i)
+		tag := f.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				// a nil pointer to an unexported type could not be allocated
+				if !f.IsExported() {
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if !visiting[ft] {
+					fields = append(fields, collectFields(ft, index, visiting)...)
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		tagged := name != ""
+		if !tagged {
+			name = f.Name
+		}
+		fields = append(fields, fieldInfo{
+			name:     name,
+			index:    index,
+			typ:      f.Type,
+			tagged:   tagged,
+			required: hasTagOption(options, "required"),
+		})
+	}
+	return fields
+}
+
+// dominantField reports whether f wins over every other field with its name.
+func dominantField(all []fieldInfo, f fieldInfo) bool {
+	for _, other := range all {
+		if other.name != f.name || reflect.DeepEqual(other.index, f.index) {
+			continue
+		}
+		switch {
+		case len(other.index) < len(f.index):
+			return false
+		case len(other.index) == len(f.index) && (other.tagged || !f.tagged):
+			return false
+		}
+	}
+	return true
+}
+
+// hasTagOption reports whether the comma-separated struct tag options contain option.
+func hasTagOption(options, option string) bool {
+	for options != "" {
+		var next string
+		next, options, _ = strings.Cut(options, ",")
+		if next == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, except that it allocates nil
+// embedded struct pointers on the way instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// lookupField matches key like encoding/json does: exact name first, then case-insensitively.
+func lookupField(fields []fieldInfo, key string) (fieldInfo, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return fieldInfo{}, false
+}
+
+// jsonTypeName names the JSON type a Go type is decoded from.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return t.String()
+	}
+}
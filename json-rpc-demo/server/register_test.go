@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type pointParams struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Label string `json:"label,omitempty"`
+	Note  string `json:"-"`
+}
+
+func TestBindParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   pointParams
+		// errors lists the expected error.data entries, nil for success
+		errors []paramError
+	}{
+		{name: "named", params: `{"x": 1, "y": 2, "label": "a"}`, want: pointParams{X: 1, Y: 2, Label: "a"}},
+		{name: "named case-insensitive", params: `{"X": 1, "Y": 2}`, want: pointParams{X: 1, Y: 2}},
+		{name: "positional", params: `[1, 2, "a"]`, want: pointParams{X: 1, Y: 2, Label: "a"}},
+		{name: "positional prefix", params: `[1]`, want: pointParams{X: 1}},
+		{name: "missing params", params: ``},
+		{name: "null params", params: `null`},
+		{
+			name:   "too many positional params",
+			params: `[1, 2, "a", 4]`,
+			errors: []paramError{{Field: "3", Message: "too many positional params: got 4, expected at most 3"}},
+		},
+		{
+			name:   "unknown named fields",
+			params: `{"x": 1, "z": 3, "Note": "hidden"}`,
+			errors: []paramError{
+				{Field: "Note", Message: "unknown field"},
+				{Field: "z", Message: "unknown field"},
+			},
+		},
+		{
+			name:   "wrong types are all reported",
+			params: `{"x": "one", "y": 1.5}`,
+			errors: []paramError{
+				{Field: "x", Message: "expected number, got string"},
+				{Field: "y", Message: "expected int, got number 1.5"},
+			},
+		},
+		{
+			name:   "positional wrong type",
+			params: `[1, true]`,
+			errors: []paramError{{Field: "y", Message: "expected number, got bool"}},
+		},
+		{
+			name:   "scalar params",
+			params: `5`,
+			errors: []paramError{{Message: "params must be an object or an array"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got pointParams
+			rpcErr := bindParams(json.RawMessage(tt.params), &got)
+			if tt.errors == nil {
+				if rpcErr != nil {
+					t.Fatalf("bindParams = %+v", rpcErr)
+				}
+				if got != tt.want {
+					t.Errorf("params = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			if rpcErr == nil {
+				t.Fatalf("bindParams succeeded with %+v", got)
+			}
+			if rpcErr.Code != -32602 {
+				t.Errorf("code = %d, want -32602", rpcErr.Code)
+			}
+			details, _ := rpcErr.Data.(map[string]any)["errors"].([]paramError)
+			if !reflect.DeepEqual(details, tt.errors) {
+				t.Errorf("errors = %+v, want %+v", details, tt.errors)
+			}
+		})
+	}
+}
+
+type Base struct {
+	ID   int    `json:"id,required"`
+	Name string `json:"name"`
+}
+
+type Extra struct {
+	Note string `json:"note"`
+}
+
+// itemParams promotes the fields of Base and Extra; its own name hides Base.Name.
+type itemParams struct {
+	Base
+	*Extra
+	Name  string `json:"name"`
+	Count int    `json:"count,required"`
+}
+
+func TestBindRequiredAndEmbedded(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   itemParams
+		errors []paramError
+	}{
+		{
+			name:   "named",
+			params: `{"id": 1, "name": "n", "note": "x", "count": 2}`,
+			want:   itemParams{Base: Base{ID: 1}, Extra: &Extra{Note: "x"}, Name: "n", Count: 2},
+		},
+		{
+			name:   "positional in promoted order",
+			params: `[1, "x", "n", 2]`,
+			want:   itemParams{Base: Base{ID: 1}, Extra: &Extra{Note: "x"}, Name: "n", Count: 2},
+		},
+		{
+			name:   "embedded pointer stays nil",
+			params: `{"id": 1, "count": 2}`,
+			want:   itemParams{Base: Base{ID: 1}, Count: 2},
+		},
+		{
+			name:   "missing named",
+			params: `{"name": "n", "bogus": 1}`,
+			errors: []paramError{
+				{Field: "bogus", Message: "unknown field"},
+				{Field: "count", Message: "missing required field"},
+				{Field: "id", Message: "missing required field"},
+			},
+		},
+		{
+			name:   "missing positional",
+			params: `[1, "x"]`,
+			errors: []paramError{{Field: "count", Message: "missing required field"}},
+		},
+		{
+			name:   "missing params",
+			params: ``,
+			errors: []paramError{
+				{Field: "id", Message: "missing required field"},
+				{Field: "count", Message: "missing required field"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got itemParams
+			rpcErr := bindParams(json.RawMessage(tt.params), &got)
+			if tt.errors == nil {
+				if rpcErr != nil {
+					t.Fatalf("bindParams = %+v", rpcErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("params = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			if rpcErr == nil {
+				t.Fatalf("bindParams succeeded with %+v", got)
+			}
+			details, _ := rpcErr.Data.(map[string]any)["errors"].([]paramError)
+			if rpcErr.Code != -32602 || !reflect.DeepEqual(details, tt.errors) {
+				t.Errorf("error = %d %+v, want -32602 %+v", rpcErr.Code, details, tt.errors)
+			}
+		})
+	}
+}
+
+func TestRegisterPointerParams(t *testing.T) {
+	useMethods(t)
+	Register("point", func(_ context.Context, p *pointParams) (*pointParams, error) {
+		return p, nil
+	})
+
+	// missing params leave the pointer nil instead of pointing at a zero struct
+	got := call(t, `[
+		{"jsonrpc": "2.0", "method": "point", "params": {"x": 1, "y": 2}, "id": 1},
+		{"jsonrpc": "2.0", "method": "point", "params": [3, 4], "id": 2},
+		{"jsonrpc": "2.0", "method": "point", "id": 3}
+	]`)
+	want := normalize(t, []byte(`[
+		{"jsonrpc": "2.0", "result": {"x": 1, "y": 2}, "id": 1},
+		{"jsonrpc": "2.0", "result": {"x": 3, "y": 4}, "id": 2},
+		{"jsonrpc": "2.0", "result": null, "id": 3}
+	]`))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("responses = %v, want %v", got, want)
+	}
+}
+
+func TestRegisterRawParams(t *testing.T) {
+	useMethods(t)
+	Register("raw", func(_ context.Context, p json.RawMessage) (json.RawMessage, error) {
+		return p, nil
+	})
+
+	// json.RawMessage params reach the handler untouched, objects and arrays alike
+	for _, params := range []string{`{"b": 1, "a": [true, null]}`, `[1, "two", {"three": 3}]`} {
+		resp, _ := handleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "method": "raw", "params": `+params+`, "id": 1}`))
+		result, err := json.Marshal(resp.(*rpcResponse).Result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, _ := json.Marshal(json.RawMessage(params))
+		if string(result) != string(compact) {
+			t.Errorf("result = %s, want %s", result, compact)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// maxMessageSize limits a single message on the stream transports, matching
+// the HTTP body limit.
+const maxMessageSize = 1 << 20
+
+// serveStdio serves one client over stdin/stdout until stdin is closed.
+// Messages use the Content-Length framing of the Language Server Protocol:
+//
+//	Content-Length: 52\r\n
+//	\r\n
+//	{"jsonrpc":"2.0","method":"math.add","params":[1,2],"id":1}
+//
+// Logs keep going to stderr, so stdout carries nothing but responses.
+func serveStdio(ctx context.Context) error {
+	return serveContentLength(withIdentity(ctx, identity{name: localIdentity}), os.Stdin, os.Stdout)
+}
+
+// serveContentLength runs serveConn over r and w with Content-Length framing.
+func serveContentLength(ctx context.Context, r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	var mu sync.Mutex
+	send := func(msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return writeContentLength(w, msg)
+	}
+	return serveConn(ctx, func() ([]byte, error) { return readContentLength(br) }, send)
+}
+
+// readContentLength reads one message framed by a Content-Length header.
+// Other headers, such as Content-Type, are ignored.
+func readContentLength(br *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	value := header.Get("Content-Length")
+	if value == "" {
+		return nil, errors.New("missing Content-Length header")
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", value)
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", length, maxMessageSize)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return body, nil
+}
+
+func writeContentLength(w io.Writer, msg []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(msg)); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// strictMode makes the server follow the JSON-RPC 2.0 specification to the
+// letter where the default handling is more forgiving:
+//
+//   - an empty batch is answered with a single Invalid Request error
+//   - every batch element is validated on its own, so a malformed element
+//     gets its own Invalid Request error instead of failing the whole batch
+//   - a request is only a notification when it has no "id" member at all;
+//     "id": null is a call whose response carries a null id
+//   - notifications are never answered, not even when they fail
+//   - ids are echoed byte for byte, so 1.0 stays 1.0
+var strictMode bool
+
+var nullID = json.RawMessage("null")
+
+// handleStrictMessage is handleMessage in strict mode.
+func handleStrictMessage(ctx context.Context, body []byte) (any, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if !json.Valid(trimmed) {
+		return strictError(-32700, "invalid JSON", nil), false
+	}
+
+	if trimmed[0] != '[' {
+		if resp := dispatchStrict(ctx, trimmed); resp != nil {
+			return resp, true
+		}
+		return nil, true
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(trimmed, &elements); err != nil {
+		return strictError(-32700, "invalid JSON batch", nil), false
+	}
+	if len(elements) == 0 {
+		return strictError(-32600, "empty batch", nil), true
+	}
+
+	results := make([]*rpcResponse, len(elements))
+	slots := make(chan struct{}, batchParallelism)
+	var wg sync.WaitGroup
+	for i, element := range elements {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, element json.RawMessage) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = dispatchStrict(ctx, element)
+		}(i, element)
+	}
+	wg.Wait()
+
+	responses := make([]rpcResponse, 0, len(results))
+	for _, resp := range results {
+		if resp != nil {
+			responses = append(responses, *resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil, true
+	}
+	return responses, true
+}
+
+// dispatchStrict validates raw as a Request object and runs it. It returns nil
+// for notifications, whatever their outcome.
+func dispatchStrict(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	req, rpcErr := decodeStrictRequest(raw)
+	if rpcErr != nil {
+		id := nullID
+		if req.ID != nil {
+			id = *req.ID
+		}
+		return strictError(rpcErr.Code, rpcErr.Message, id)
+	}
+
+	resp := dispatchRequest(ctx, req)
+	if req.ID == nil || resp == nil {
+		return nil
+	}
+	// echo the id exactly as it was sent
+	resp.ID = *req.ID
+	if resp.Error == nil && resp.Result == nil {
+		resp.Result = nullID
+	}
+	return resp
+}
+
+// decodeStrictRequest checks the members of a Request object against the
+// specification. req.ID is set whenever the request has a usable id, so
+// that errors can still be answered with it; "id": null counts as an id.
+func decodeStrictRequest(raw json.RawMessage) (rpcRequest, *rpcError) {
+	var req rpcRequest
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return req, &rpcError{Code: -32600, Message: "request must be an object"}
+	}
+
+	if id, ok := members["id"]; ok {
+		switch jsonKind(id) {
+		case 'n', '"', '0':
+			req.ID = &id
+		default:
+			return req, &rpcError{Code: -32600, Message: "id must be a string, a number or null"}
+		}
+	}
+
+	if err := json.Unmarshal(members["jsonrpc"], &req.JSONRPC); err != nil || req.JSONRPC != jsonRPCVersion {
+		return req, &rpcError{Code: -32600, Message: "jsonrpc field must be \"2.0\""}
+	}
+	if err := json.Unmarshal(members["method"], &req.Method); err != nil || req.Method == "" {
+		return req, &rpcError{Code: -32600, Message: "method must be a non-empty string"}
+	}
+	if params, ok := members["params"]; ok {
+		if kind := jsonKind(params); kind != '{' && kind != '[' {
+			return req, &rpcError{Code: -32600, Message: "params must be an object or an array"}
+		}
+		req.Params = params
+	}
+	return req, nil
+}
+
+// jsonKind classifies a valid JSON value by its first byte: '{', '[', '"',
+// 't'/'f' for booleans, 'n' for null and '0' for numbers.
+func jsonKind(raw json.RawMessage) byte {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return 0
+	}
+	switch c := trimmed[0]; c {
+	case '{', '[', '"', 't', 'f', 'n':
+		return c
+	default:
+		return '0'
+	}
+}
+
+func strictError(code int, message string, id json.RawMessage) *rpcResponse {
+	if id == nil {
+		id = nullID
+	}
+	return &rpcResponse{JSONRPC: jsonRPCVersion, Error: &rpcError{Code: code, Message: message}, ID: id}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+)
+
+// listenUnix accepts JSON-RPC clients on a Unix socket at path. Messages are
+// newline-delimited: every line holds one request or batch, and every
+// response is written as one line.
+func listenUnix(path string) (net.Listener, error) {
+	// a socket file left over from an earlier run would make Listen fail
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("unix socket accept failed: %v", err)
+				}
+				return
+			}
+			go serveUnixConn(conn)
+		}
+	}()
+	return ln, nil
+}
+
+func serveUnixConn(conn net.Conn) {
+	defer conn.Close()
+	log.Printf("unix socket client connected")
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	next := func() ([]byte, error) {
+		for scanner.Scan() {
+			// the scanner reuses its buffer, so hand out a copy
+			if line := scanner.Bytes(); len(line) > 0 {
+				return append([]byte(nil), line...), nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	var mu sync.Mutex
+	send := func(msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := conn.Write(append(msg, '\n'))
+		return err
+	}
+
+	if err := serveConn(withIdentity(context.Background(), identity{name: localIdentity}), next, send); err != nil {
+		log.Printf("unix socket read failed: %v", err)
+	}
+	log.Printf("unix socket client disconnected")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"go-streamable-http/websocket"
+)
+
+// wsHandler serves JSON-RPC over WebSocket: one request or batch per text
+// message, see serveConn. The protocol itself comes from the websocket package
+// of go-streamable-http, which this module uses through a replace directive.
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	// credentials come with the upgrade request and hold for the whole connection
+	ctx := withIdentity(r.Context(), authn.authenticate(r, nil))
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("websocket upgrade failed: %v", err)
+		return
+	}
+	log.Printf("websocket client connected: %s", r.RemoteAddr)
+
+	next := func() ([]byte, error) {
+		opcode, msg, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if opcode != websocket.OpText {
+			conn.Close(websocket.CloseUnsupportedData, "JSON-RPC messages must be text")
+			return nil, errors.New("received a binary message")
+		}
+		return msg, nil
+	}
+	err = serveConn(ctx, next, conn.WriteText)
+	if err != nil && !errors.Is(err, websocket.ErrClosed) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		log.Printf("websocket read failed: %v", err)
+	}
+	conn.Close(websocket.CloseNormal, "")
+	log.Printf("websocket client disconnected: %s", r.RemoteAddr)
+}